@@ -20,13 +20,18 @@ import (
 	"html"
 	"net/http"
 	"reflect"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig"
 	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp/push"
+	"github.com/caddyserver/caddy/v2/modules/caddypki/acmeserver"
 	"github.com/caddyserver/caddy/v2/modules/caddytls"
+	"github.com/caddyserver/caddy/v2/modules/logging"
 	"go.uber.org/zap/zapcore"
 )
 
@@ -40,6 +45,8 @@ func init() {
 	RegisterHandlerDirective("handle", parseHandle)
 	RegisterDirective("handle_errors", parseHandleErrors)
 	RegisterDirective("log", parseLog)
+	RegisterHandlerDirective("push", parsePush)
+	RegisterHandlerDirective("acme_server", parseACMEServer)
 }
 
 // parseBind parses the bind directive. Syntax:
@@ -103,6 +110,17 @@ func parseRoot(h Helper) ([]ConfigValue, error) {
 //         load      <paths...>
 //         ca        <acme_ca_endpoint>
 //         dns       <provider_name>
+//         ocsp {
+//             disable_stapling
+//             responder_override <url>
+//             refresh_interval   <duration>
+//             must_staple
+//         }
+//         client_auth {
+//             mode                  <mode>
+//             trusted_ca_cert_file  <paths...>
+//             trusted_leaf_cert     <hexes...>
+//         }
 //     }
 //
 func parseTLS(h Helper) ([]ConfigValue, error) {
@@ -270,6 +288,72 @@ func parseTLS(h Helper) ([]ConfigValue, error) {
 				}
 				mgr.TrustedRootsPEMFiles = append(mgr.TrustedRootsPEMFiles, arg[0])
 
+			// OCSP stapling behavior for certificates under this automation policy
+			case "ocsp":
+				ocspCfg := caddytls.OCSPConfig{}
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					switch h.Val() {
+					case "disable_stapling":
+						ocspCfg.DisableStapling = true
+					case "responder_override":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						ocspCfg.ResponderOverride = h.Val()
+					case "refresh_interval":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						dur, err := time.ParseDuration(h.Val())
+						if err != nil {
+							return nil, h.Errf("parsing OCSP refresh_interval: %v", err)
+						}
+						ocspCfg.RefreshInterval = dur
+					case "must_staple":
+						ocspCfg.MustStaple = true
+					default:
+						return nil, h.Errf("unrecognized ocsp subdirective: %s", h.Val())
+					}
+				}
+				if err := ocspCfg.Validate(); err != nil {
+					return nil, h.Errf("invalid ocsp config: %v", err)
+				}
+				mgr.OCSP = ocspCfg
+
+			// mTLS: require and/or verify client certificates on this connection policy
+			case "client_auth":
+				if cp == nil {
+					cp = new(caddytls.ConnectionPolicy)
+				}
+				clientAuth := caddytls.ClientAuthentication{}
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					switch h.Val() {
+					case "mode":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						clientAuth.Mode = h.Val()
+					case "trusted_ca_cert_file":
+						args := h.RemainingArgs()
+						if len(args) == 0 {
+							return nil, h.ArgErr()
+						}
+						clientAuth.TrustedCACerts = append(clientAuth.TrustedCACerts, args...)
+					case "trusted_leaf_cert":
+						args := h.RemainingArgs()
+						if len(args) == 0 {
+							return nil, h.ArgErr()
+						}
+						clientAuth.TrustedLeafCerts = append(clientAuth.TrustedLeafCerts, args...)
+					default:
+						return nil, h.Errf("unrecognized client_auth subdirective: %s", h.Val())
+					}
+				}
+				if err := clientAuth.Validate(); err != nil {
+					return nil, h.Errf("invalid client_auth config: %v", err)
+				}
+				cp.ClientAuthentication = &clientAuth
+
 			default:
 				return nil, h.Errf("unknown subdirective: %s", h.Val())
 			}
@@ -381,6 +465,99 @@ func parseRespond(h Helper) (caddyhttp.MiddlewareHandler, error) {
 	return sr, nil
 }
 
+// parsePush parses the push directive. Syntax:
+//
+//     push [<matcher>] <path> {
+//         resources <paths...>
+//         method    <verb>
+//         header    <name> <value>
+//         link_preload
+//     }
+//
+// <path> is the triggering condition for the push: it's the request
+// path that causes the resources to be pushed, not itself a resource
+// to push (you don't push the page that's already being served).
+// It's implemented as a "path" matcher wrapping the handler, the
+// same way a [<matcher>] token would be. The path and any resources
+// may be omitted if link_preload is used, in which case this handler
+// only sniffs downstream Link: <url>; rel=preload response headers
+// to decide what to push.
+func parsePush(h Helper) (caddyhttp.MiddlewareHandler, error) {
+	handler := new(push.Handler)
+	var triggerPaths []string
+
+	for h.Next() {
+		triggerPaths = append(triggerPaths, h.RemainingArgs()...)
+		var resources []string
+		var method string
+
+		for h.NextBlock(0) {
+			switch h.Val() {
+			case "resources":
+				resources = append(resources, h.RemainingArgs()...)
+
+			case "method":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				method = h.Val()
+
+			case "header":
+				args := h.RemainingArgs()
+				if len(args) != 2 {
+					return nil, h.ArgErr()
+				}
+				if handler.Headers == nil {
+					handler.Headers = make(http.Header)
+				}
+				handler.Headers.Add(args[0], args[1])
+
+			case "link_preload":
+				handler.LinkHeaderSniff = true
+
+			default:
+				return nil, h.Errf("unrecognized subdirective: %s", h.Val())
+			}
+		}
+
+		for _, rsc := range resources {
+			handler.Resources = append(handler.Resources, push.Resource{
+				Target: rsc,
+				Method: method,
+			})
+		}
+	}
+
+	if len(triggerPaths) == 0 {
+		return handler, nil
+	}
+
+	pathMatcherJSON, err := json.Marshal(triggerPaths)
+	if err != nil {
+		return nil, h.Errf("marshaling push path matcher: %v", err)
+	}
+
+	return &caddyhttp.Subroute{
+		Routes: []caddyhttp.Route{
+			{
+				MatcherSetsRaw: []caddy.ModuleMap{{"path": pathMatcherJSON}},
+				HandlersRaw: []json.RawMessage{
+					caddyconfig.JSONModuleObject(handler, "handler", "push", nil),
+				},
+			},
+		},
+	}, nil
+}
+
+// parseACMEServer parses the acme_server directive, which has no
+// special syntax of its own: it just hands its block off to
+// acmeserver.Handler's own Caddyfile unmarshaler.
+func parseACMEServer(h Helper) (caddyhttp.MiddlewareHandler, error) {
+	handler := new(acmeserver.Handler)
+	err := handler.UnmarshalCaddyfile(h.Dispenser)
+	return handler, err
+}
+
 // parseRoute parses the route directive.
 func parseRoute(h Helper) (caddyhttp.MiddlewareHandler, error) {
 	sr := new(caddyhttp.Subroute)
@@ -437,12 +614,25 @@ func parseHandleErrors(h Helper) ([]ConfigValue, error) {
 //         output <writer_module> ...
 //         format <encoder_module> ...
 //         level  <level>
+//         sampling {
+//             interval   <duration>
+//             initial    <n>
+//             thereafter <n>
+//         }
+//         redact <field> ...
+//         hash   <field> ...
 //     }
 //
+// redact and hash name fields of the configured format's encoded
+// output that should be replaced with "REDACTED" or a salted
+// SHA-256 digest (the salt coming from the log_hash_salt global
+// option) respectively, before the log line is written.
+//
 func parseLog(h Helper) ([]ConfigValue, error) {
 	var configValues []ConfigValue
 	for h.Next() {
 		cl := new(caddy.CustomLog)
+		var redactFields, hashFields []string
 
 		for h.NextBlock(0) {
 			switch h.Val() {
@@ -516,11 +706,80 @@ func parseLog(h Helper) ([]ConfigValue, error) {
 					return nil, h.ArgErr()
 				}
 
+			case "sampling":
+				sampling := new(caddy.LogSampling)
+				for nesting := h.Nesting(); h.NextBlock(nesting); {
+					switch h.Val() {
+					case "interval":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						dur, err := time.ParseDuration(h.Val())
+						if err != nil {
+							return nil, h.Errf("parsing sampling interval: %v", err)
+						}
+						sampling.Interval = dur
+
+					case "initial":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						initial, err := strconv.Atoi(h.Val())
+						if err != nil {
+							return nil, h.Errf("parsing sampling initial count: %v", err)
+						}
+						sampling.First = initial
+
+					case "thereafter":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						thereafter, err := strconv.Atoi(h.Val())
+						if err != nil {
+							return nil, h.Errf("parsing sampling thereafter count: %v", err)
+						}
+						sampling.Thereafter = thereafter
+
+					default:
+						return nil, h.Errf("unrecognized sampling subdirective: %s", h.Val())
+					}
+				}
+				cl.Sampling = sampling
+
+			case "redact", "hash":
+				fieldKind := h.Val()
+				fields := h.RemainingArgs()
+				if len(fields) == 0 {
+					return nil, h.ArgErr()
+				}
+				if fieldKind == "redact" {
+					redactFields = append(redactFields, fields...)
+				} else {
+					hashFields = append(hashFields, fields...)
+				}
+
 			default:
 				return nil, h.Errf("unrecognized subdirective: %s", h.Val())
 			}
 		}
 
+		if len(redactFields) > 0 || len(hashFields) > 0 {
+			if cl.EncoderRaw == nil {
+				return nil, h.Errf("redact and hash require a format to be configured first")
+			}
+			var salt string
+			if saltOpt := h.Option("log_hash_salt"); saltOpt != nil {
+				salt = saltOpt.(string)
+			}
+			redactEnc := &logging.RedactEncoder{
+				WrapRaw: cl.EncoderRaw,
+				Redact:  redactFields,
+				Hash:    hashFields,
+				Salt:    salt,
+			}
+			cl.EncoderRaw = caddyconfig.JSONModuleObject(redactEnc, "format", "redact", h.warnings)
+		}
+
 		var val namedCustomLog
 		if !reflect.DeepEqual(cl, new(caddy.CustomLog)) {
 			cl.Include = []string{"http.log.access"}
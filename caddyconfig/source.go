@@ -0,0 +1,43 @@
+package caddyconfig
+
+import "sync"
+
+// Source is a pluggable origin for Caddy's initial configuration
+// document (before it is adapted into Caddy's native JSON config).
+// Sources are registered under a name corresponding to the scheme
+// of a "--config" value, e.g. registering "http" allows
+// "--config http://example.com/caddy.json". This lets Caddy be
+// bootstrapped from a remote configuration store (an HTTP(S)
+// endpoint, an environment variable, a KV store via a third-party
+// module, etc.) without external tooling to fetch the config first.
+type Source interface {
+	// Load returns the raw bytes of the config document named by
+	// loc, which is the same string the Source was dispatched with
+	// (including its "scheme://" prefix).
+	Load(loc string) ([]byte, error)
+}
+
+// RegisterSource registers a config source under name, which
+// should be the URL scheme it handles (without "://"). It panics
+// if name is already registered, analogous to RegisterAdapter.
+func RegisterSource(name string, source Source) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	if _, ok := sources[name]; ok {
+		panic("config source already registered: " + name)
+	}
+	sources[name] = source
+}
+
+// GetSource returns the source registered under name, or nil if
+// there isn't one.
+func GetSource(name string) Source {
+	sourcesMu.RLock()
+	defer sourcesMu.RUnlock()
+	return sources[name]
+}
+
+var (
+	sourcesMu sync.RWMutex
+	sources   = make(map[string]Source)
+)
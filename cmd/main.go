@@ -106,9 +106,9 @@ func loadConfig(configFile, adapterName string) ([]byte, error) {
 	var cfgAdapter caddyconfig.Adapter
 	var err error
 	if configFile != "" {
-		config, err = ioutil.ReadFile(configFile)
+		config, err = readConfigFromSource(configFile)
 		if err != nil {
-			return nil, fmt.Errorf("reading config file: %v", err)
+			return nil, fmt.Errorf("loading config: %v", err)
 		}
 		caddy.Log().Info("using provided configuration",
 			zap.String("config_file", configFile),
@@ -170,6 +170,37 @@ func loadConfig(configFile, adapterName string) ([]byte, error) {
 	return config, nil
 }
 
+// readConfigFromSource reads the raw config document named by
+// configFile. If configFile looks like a "scheme://..." URL, it is
+// dispatched to the caddyconfig.Source registered for that scheme
+// (e.g. "file", "http", "https", "env"); "-" reads from stdin; and
+// anything else is treated as a local file path, same as before
+// this indirection was added. This is what lets --config point at
+// a remote configuration store instead of only a local file.
+func readConfigFromSource(configFile string) ([]byte, error) {
+	if configFile == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	if scheme, _, ok := splitSourceScheme(configFile); ok {
+		source := caddyconfig.GetSource(scheme)
+		if source == nil {
+			return nil, fmt.Errorf("no config source registered for scheme %q", scheme)
+		}
+		return source.Load(configFile)
+	}
+	return ioutil.ReadFile(configFile)
+}
+
+// splitSourceScheme reports whether configFile has a "scheme://"
+// prefix, and if so, returns the scheme and the rest of the string.
+func splitSourceScheme(configFile string) (scheme, rest string, ok bool) {
+	idx := strings.Index(configFile, "://")
+	if idx < 0 {
+		return "", "", false
+	}
+	return configFile[:idx], configFile[idx+len("://"):], true
+}
+
 // Flags wraps a FlagSet so that typed values
 // from flags can be easily retrieved.
 type Flags struct {
@@ -1,8 +1,11 @@
 package headers
 
 import (
+	"fmt"
 	"net/http"
+	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/caddyserver/caddy"
 	"github.com/caddyserver/caddy/modules/caddyhttp"
@@ -24,9 +27,20 @@ type Headers struct {
 // HeaderOps defines some operations to
 // perform on HTTP headers.
 type HeaderOps struct {
-	Add    http.Header `json:"add,omitempty"`
-	Set    http.Header `json:"set,omitempty"`
-	Delete []string    `json:"delete,omitempty"`
+	Add     http.Header                    `json:"add,omitempty"`
+	Set     http.Header                    `json:"set,omitempty"`
+	Replace map[string][]HeaderReplacement `json:"replace,omitempty"`
+	Delete  []string                       `json:"delete,omitempty"`
+}
+
+// HeaderReplacement describes a find-and-replace
+// on a header's value. Search is compiled as a
+// regular expression, and Replace may reference
+// its capture groups (e.g. "$1") in addition to
+// Caddy placeholders.
+type HeaderReplacement struct {
+	Search  string `json:"search,omitempty"`
+	Replace string `json:"replace,omitempty"`
 }
 
 // RespHeaderOps is like HeaderOps, but
@@ -37,6 +51,36 @@ type RespHeaderOps struct {
 	Deferred bool                       `json:"deferred,omitempty"`
 }
 
+// Validate ensures h's configuration is usable. In particular, it
+// compiles every Replace pattern so that a typo'd regular expression
+// fails config load instead of silently becoming a no-op the first
+// time it's used to handle a request.
+func (h Headers) Validate() error {
+	if err := validateReplacements(h.Request); err != nil {
+		return err
+	}
+	if h.Response != nil {
+		if err := validateReplacements(h.Response.HeaderOps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateReplacements(ops *HeaderOps) error {
+	if ops == nil {
+		return nil
+	}
+	for fieldName, replacements := range ops.Replace {
+		for _, r := range replacements {
+			if _, err := getRegexp(r.Search); err != nil {
+				return fmt.Errorf("invalid replace pattern for header %q: %v", fieldName, err)
+			}
+		}
+	}
+	return nil
+}
+
 func (h Headers) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
 	repl := r.Context().Value(caddy.ReplacerCtxKey).(caddy.Replacer)
 	apply(h.Request, r.Header, repl)
@@ -67,11 +111,50 @@ func apply(ops *HeaderOps, hdr http.Header, repl caddy.Replacer) {
 		}
 		hdr.Set(fieldName, strings.Join(vals, ","))
 	}
+	for fieldName, replacements := range ops.Replace {
+		fieldName = repl.ReplaceAll(fieldName, "")
+		vals, ok := hdr[http.CanonicalHeaderKey(fieldName)]
+		if !ok {
+			continue
+		}
+		for i, val := range vals {
+			for _, r := range replacements {
+				// Search patterns are validated at config load time
+				// (see Validate), so a compile error here shouldn't
+				// happen in practice; skip the replacement rather
+				// than fail the request if it somehow does.
+				re, err := getRegexp(r.Search)
+				if err != nil {
+					continue
+				}
+				replacement := repl.ReplaceAll(r.Replace, "")
+				val = re.ReplaceAllString(val, replacement)
+			}
+			vals[i] = val
+		}
+	}
 	for _, fieldName := range ops.Delete {
 		hdr.Del(repl.ReplaceAll(fieldName, ""))
 	}
 }
 
+// regexpCache memoizes compiled regular expressions so that
+// repeated requests don't pay the cost of recompiling the
+// same Search pattern over and over.
+var regexpCache sync.Map // map[string]*regexp.Regexp
+
+func getRegexp(pattern string) (*regexp.Regexp, error) {
+	if cached, ok := regexpCache.Load(pattern); ok {
+		return cached.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	actual, _ := regexpCache.LoadOrStore(pattern, re)
+	return actual.(*regexp.Regexp), nil
+}
+
 // responseWriterWrapper defers response header
 // operations until WriteHeader is called.
 type responseWriterWrapper struct {
@@ -102,6 +185,7 @@ func (rww *responseWriterWrapper) Write(d []byte) (int, error) {
 
 // Interface guards
 var (
+	_ caddy.Validator             = (*Headers)(nil)
 	_ caddyhttp.MiddlewareHandler = (*Headers)(nil)
 	_ caddyhttp.HTTPInterfaces    = (*responseWriterWrapper)(nil)
 )
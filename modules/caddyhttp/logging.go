@@ -19,9 +19,13 @@ import (
 	"net"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"golang.org/x/time/rate"
 
 	"github.com/caddyserver/caddy/v2"
 )
@@ -64,68 +68,187 @@ type ServerLogConfig struct {
 	// and this includes some request and response headers, i.e `Cookie`,
 	// `Set-Cookie`, `Authorization`, and `Proxy-Authorization`.
 	ShouldLogCredentials bool `json:"should_log_credentials,omitempty"`
+
+	// Sampling configures log entry sampling, similar to zap's own
+	// sampling core: within each Interval, the first Initial entries
+	// with the same level and message are let through, then only one
+	// out of every Thereafter such entries, with the rest dropped. This keeps a noisy repeated log line from flooding
+	// the destination while still giving a representative sample.
+	Sampling *Sampling `json:"sampling,omitempty"`
+
+	// MaxEventsPerSecond, if set, caps the number of log entries
+	// emitted per second for a resolved logger name, keyed by the
+	// request host that resolves to it. The host key is resolved
+	// using the same exact/port-stripped/wildcard precedence as
+	// LoggerMapping (see getLoggerHosts). This protects against a
+	// single noisy virtual host drowning out the rest, or blowing
+	// up disk/ingest costs, regardless of the Sampling settings.
+	MaxEventsPerSecond map[string]float64 `json:"max_events_per_second,omitempty"`
+
+	limitersMu sync.Mutex
+	limiters   map[string]*rate.Limiter
+}
+
+// Sampling configures log entry sampling.
+type Sampling struct {
+	// The window over which to apply the rule.
+	Interval time.Duration `json:"interval,omitempty"`
+
+	// The number of entries with the same level and message to
+	// allow through per interval before sampling kicks in.
+	Initial int `json:"initial,omitempty"`
+
+	// After the initial burst, only allow one out of every
+	// Thereafter entries with the same level and message through,
+	// per interval.
+	Thereafter int `json:"thereafter,omitempty"`
 }
 
 // wrapLogger wraps logger in one or more logger named
-// according to user preferences for the given host.
-func (slc ServerLogConfig) wrapLogger(logger *zap.Logger, host string) []*zap.Logger {
+// according to user preferences for the given host. Loggers
+// that exceed their configured MaxEventsPerSecond are
+// dropped for this call; the rest have Sampling, if any,
+// applied to their core.
+func (slc *ServerLogConfig) wrapLogger(logger *zap.Logger, host string) []*zap.Logger {
 	hosts := slc.getLoggerHosts(host)
+	rateLimit, hasRateLimit := slc.getLoggerRateLimit(host)
 	loggers := make([]*zap.Logger, 0, len(hosts))
 	for _, loggerName := range hosts {
 		if loggerName == "" {
 			continue
 		}
-		loggers = append(loggers, logger.Named(loggerName))
+		if hasRateLimit && !slc.allow(loggerName, rateLimit) {
+			atomic.AddInt64(&droppedLogEvents, 1)
+			continue
+		}
+		named := logger.Named(loggerName)
+		if slc.Sampling != nil {
+			sampling := slc.Sampling
+			named = named.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+				return zapcore.NewSamplerWithOptions(core, sampling.Interval, sampling.Initial, sampling.Thereafter)
+			}))
+		}
+		loggers = append(loggers, named)
 	}
 	return loggers
 }
 
-func (slc ServerLogConfig) getLoggerHosts(host string) []string {
-	tryHost := func(key string) ([]string, bool) {
-		// first try exact match
-		if hosts, ok := slc.LoggerMapping[key]; ok {
-			return hosts, ok
-		}
-		// strip port and try again (i.e. Host header of "example.com:1234" should
-		// match "example.com" if there is no "example.com:1234" in the map)
-		hostOnly, _, err := net.SplitHostPort(key)
-		if err != nil {
-			return []string{}, false
-		}
-		if hosts, ok := slc.LoggerMapping[hostOnly]; ok {
-			return hosts, ok
+// allow reports whether an event for the given resolved logger
+// name is allowed through its token-bucket rate limiter, creating
+// the limiter (with a burst equal to the rate) the first time it
+// is used.
+func (slc *ServerLogConfig) allow(loggerName string, eventsPerSecond float64) bool {
+	slc.limitersMu.Lock()
+	if slc.limiters == nil {
+		slc.limiters = make(map[string]*rate.Limiter)
+	}
+	limiter, ok := slc.limiters[loggerName]
+	if !ok {
+		burst := int(eventsPerSecond)
+		if burst < 1 {
+			burst = 1
 		}
+		limiter = rate.NewLimiter(rate.Limit(eventsPerSecond), burst)
+		slc.limiters[loggerName] = limiter
+	}
+	slc.limitersMu.Unlock()
+	return limiter.Allow()
+}
 
-		// Now try the deprecated LoggerNames
-
-		// first try exact match
-		if host, ok := slc.LoggerNames[key]; ok {
-			return []string{host}, ok
-		}
-		// strip port and try again (i.e. Host header of "example.com:1234" should
-		// match "example.com" if there is no "example.com:1234" in the map)
-		hostOnly, _, err = net.SplitHostPort(key)
-		if err != nil {
-			return []string{}, false
+// getLoggerRateLimit resolves the MaxEventsPerSecond setting that
+// applies to the given request host, using the same resolution
+// order (exact, then port-stripped, then increasingly generic
+// wildcards) as getLoggerHosts.
+func (slc *ServerLogConfig) getLoggerRateLimit(host string) (float64, bool) {
+	if len(slc.MaxEventsPerSecond) == 0 {
+		return 0, false
+	}
+	for _, key := range hostLookupKeys(host) {
+		if limit, ok := slc.MaxEventsPerSecond[key]; ok {
+			return limit, true
 		}
-		host, ok := slc.LoggerNames[hostOnly]
-		return []string{host}, ok
 	}
+	if limit, ok := slc.MaxEventsPerSecond[""]; ok {
+		return limit, true
+	}
+	return 0, false
+}
+
+// hostLookupKeys returns, in the same precedence order that
+// getLoggerHosts resolves a custom logger for host, every key that
+// could be looked up in a per-host map such as MaxEventsPerSecond:
+// the exact host (and its port-stripped form), then each wildcard
+// form of the hostname (e.g. "sub.example.com" also yields
+// "*.example.com", "*.*.com" and "*.*.*"), each likewise with its
+// port-stripped form.
+func hostLookupKeys(host string) []string {
+	var keys []string
+	for _, level := range hostWildcardLevels(host) {
+		keys = append(keys, hostAndPortStripped(level)...)
+	}
+	return keys
+}
 
-	// try the exact hostname first
-	if hosts, ok := tryHost(host); ok {
-		return hosts
+// hostAndPortStripped returns host, followed by host with any port
+// stripped, if host actually had a port.
+func hostAndPortStripped(host string) []string {
+	keys := []string{host}
+	if hostOnly, _, err := net.SplitHostPort(host); err == nil {
+		keys = append(keys, hostOnly)
 	}
+	return keys
+}
 
-	// try matching wildcard domains if other non-specific loggers exist
+// hostWildcardLevels returns host, followed by each of its wildcard
+// forms from least to most general, replacing one more dot-separated
+// label with "*" at each step (e.g. "sub.example.com" also yields
+// "*.example.com", "*.*.com" and "*.*.*").
+func hostWildcardLevels(host string) []string {
+	levels := []string{host}
 	labels := strings.Split(host, ".")
 	for i := range labels {
 		if labels[i] == "" {
 			continue
 		}
 		labels[i] = "*"
-		wildcardHost := strings.Join(labels, ".")
-		if hosts, ok := tryHost(wildcardHost); ok {
+		levels = append(levels, strings.Join(labels, "."))
+	}
+	return levels
+}
+
+// droppedLogEvents counts access log entries dropped because they
+// exceeded a logger's MaxEventsPerSecond.
+var droppedLogEvents int64
+
+// DroppedLogEvents returns the number of access log entries that
+// have been dropped so far, process-wide, because they exceeded a
+// configured MaxEventsPerSecond. It is exported for callers that
+// want to surface this as a metric (e.g. over the admin API or a
+// Prometheus exporter), but nothing in this module calls it itself.
+func DroppedLogEvents() int64 {
+	return atomic.LoadInt64(&droppedLogEvents)
+}
+
+func (slc ServerLogConfig) getLoggerHosts(host string) []string {
+	tryHost := func(key string) ([]string, bool) {
+		// try LoggerMapping first (exact, then port-stripped)
+		for _, k := range hostAndPortStripped(key) {
+			if hosts, ok := slc.LoggerMapping[k]; ok {
+				return hosts, ok
+			}
+		}
+		// now try the deprecated LoggerNames (exact, then port-stripped)
+		for _, k := range hostAndPortStripped(key) {
+			if name, ok := slc.LoggerNames[k]; ok {
+				return []string{name}, ok
+			}
+		}
+		return nil, false
+	}
+
+	// try the exact hostname first, then increasingly generic wildcard forms
+	for _, level := range hostWildcardLevels(host) {
+		if hosts, ok := tryHost(level); ok {
 			return hosts
 		}
 	}
@@ -141,6 +264,8 @@ func (slc *ServerLogConfig) clone() *ServerLogConfig {
 		SkipHosts:            append([]string{}, slc.SkipHosts...),
 		SkipUnmappedHosts:    slc.SkipUnmappedHosts,
 		ShouldLogCredentials: slc.ShouldLogCredentials,
+		Sampling:             slc.Sampling,
+		MaxEventsPerSecond:   make(map[string]float64),
 	}
 	for k, v := range slc.LoggerNames {
 		clone.LoggerNames[k] = v
@@ -148,6 +273,9 @@ func (slc *ServerLogConfig) clone() *ServerLogConfig {
 	for k, v := range slc.LoggerMapping {
 		clone.LoggerMapping[k] = append([]string{}, v...)
 	}
+	for k, v := range slc.MaxEventsPerSecond {
+		clone.MaxEventsPerSecond[k] = v
+	}
 	return clone
 }
 
@@ -0,0 +1,232 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package push implements HTTP/2 server push as Caddy middleware.
+package push
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func init() {
+	caddy.RegisterModule(Handler{})
+}
+
+// Handler implements a middleware that can initiate an HTTP/2
+// server push for specific requests, and optionally sniff
+// downstream responses for Link: <url>; rel=preload headers to
+// push those resources too. If the connection doesn't support
+// HTTP/2 server push (e.g. HTTP/1.1), it degrades gracefully by
+// simply not pushing anything.
+type Handler struct {
+	// Resources to push whenever this handler's routes match.
+	Resources []Resource `json:"resources,omitempty"`
+
+	// Headers are extra headers to add to all push requests.
+	Headers http.Header `json:"headers,omitempty"`
+
+	// LinkHeaderSniff, if true, causes this handler to push
+	// resources named in any Link: <url>; rel=preload response
+	// headers emitted further down the middleware chain (for
+	// example, by a reverse_proxy'd backend), in addition to
+	// (or instead of) the configured Resources.
+	LinkHeaderSniff bool `json:"link_header_sniff,omitempty"`
+}
+
+// Resource represents a request for a resource to push.
+type Resource struct {
+	// Method is the request method for the push; defaults to GET.
+	Method string `json:"method,omitempty"`
+
+	// Target is the path (and optionally query string) of the
+	// resource to push. It may contain placeholders.
+	Target string `json:"target"`
+
+	// Header contains extra headers to add to this specific push
+	// request, merged with the handler's Headers.
+	Header http.Header `json:"header,omitempty"`
+}
+
+// CaddyModule returns the Caddy module information.
+func (Handler) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.push",
+		New: func() caddy.Module { return new(Handler) },
+	}
+}
+
+func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	repl := r.Context().Value(caddy.ReplacerCtxKey).(caddy.Replacer)
+
+	pusher, ok := w.(http.Pusher)
+	if !ok {
+		// http.Pusher isn't available on this connection (e.g. it's
+		// not HTTP/2); nothing we can do but continue the chain
+		return next.ServeHTTP(w, r)
+	}
+
+	pushed := newDedupeSet()
+
+	for _, rsc := range h.Resources {
+		h.push(pusher, rsc, repl, pushed)
+	}
+
+	if h.LinkHeaderSniff {
+		w = &linkSniffResponseWriter{
+			ResponseWriterWrapper: &caddyhttp.ResponseWriterWrapper{ResponseWriter: w},
+			pusher:                pusher,
+			extraHeaders:          h.Headers,
+			repl:                  repl,
+			pushed:                pushed,
+		}
+	}
+
+	err := next.ServeHTTP(w, r)
+
+	if len(pushed.Resources) > 0 {
+		repl.Set("http.push.resource", strings.Join(pushed.Resources, ","))
+	}
+
+	return err
+}
+
+// push issues a single server push for rsc, expanding placeholders
+// in its target first, and skipping it if it's already been
+// pushed (tracked via pushed) during this request. Pushing is an
+// optimization, not a correctness requirement, so any error from
+// the underlying Push call is deliberately ignored.
+func (h Handler) push(pusher http.Pusher, rsc Resource, repl caddy.Replacer, pushed *dedupeSet) {
+	target := repl.ReplaceAll(rsc.Target, "")
+	if !pushed.add(target) {
+		return
+	}
+
+	method := rsc.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	hdr := make(http.Header)
+	for k, v := range h.Headers {
+		hdr[k] = v
+	}
+	for k, v := range rsc.Header {
+		hdr[k] = v
+	}
+
+	_ = pusher.Push(target, &http.PushOptions{Method: method, Header: hdr})
+}
+
+// linkSniffResponseWriter watches the downstream handler's
+// response headers and, when it sees a Link: <url>; rel=preload
+// header, issues a push for each such URL before the headers are
+// actually written to the client.
+type linkSniffResponseWriter struct {
+	*caddyhttp.ResponseWriterWrapper
+	pusher       http.Pusher
+	extraHeaders http.Header
+	repl         caddy.Replacer
+	pushed       *dedupeSet
+	wroteHeader  bool
+}
+
+func (lw *linkSniffResponseWriter) WriteHeader(status int) {
+	if lw.wroteHeader {
+		return
+	}
+	lw.wroteHeader = true
+	for _, target := range preloadTargets(lw.ResponseWriterWrapper.Header()) {
+		target = lw.repl.ReplaceAll(target, "")
+		if lw.pushed.add(target) {
+			_ = lw.pusher.Push(target, &http.PushOptions{Header: lw.extraHeaders})
+		}
+	}
+	lw.ResponseWriterWrapper.WriteHeader(status)
+}
+
+func (lw *linkSniffResponseWriter) Write(d []byte) (int, error) {
+	if !lw.wroteHeader {
+		lw.WriteHeader(http.StatusOK)
+	}
+	return lw.ResponseWriterWrapper.Write(d)
+}
+
+// preloadTargets extracts the URLs out of any Link header values
+// that carry a rel=preload parameter, e.g.
+// `Link: </app.js>; rel=preload`.
+func preloadTargets(hdr http.Header) []string {
+	var targets []string
+	for _, line := range hdr["Link"] {
+		for _, part := range strings.Split(line, ",") {
+			fields := strings.Split(part, ";")
+			if len(fields) < 2 {
+				continue
+			}
+			isPreload := false
+			for _, field := range fields[1:] {
+				field = strings.TrimSpace(field)
+				if field == `rel=preload` || field == `rel="preload"` {
+					isPreload = true
+					break
+				}
+			}
+			if !isPreload {
+				continue
+			}
+			target := strings.TrimSpace(fields[0])
+			target = strings.TrimPrefix(target, "<")
+			target = strings.TrimSuffix(target, ">")
+			if target != "" {
+				targets = append(targets, target)
+			}
+		}
+	}
+	return targets
+}
+
+// dedupeSet tracks which resources have already been pushed
+// during a single request, so the same target isn't pushed twice
+// just because it was both configured as a Resource and sniffed
+// from a Link header. The accumulated Resources also back the
+// "{http.push.resource}" placeholder, set once ServeHTTP knows no
+// further pushes are coming.
+type dedupeSet struct {
+	seen      map[string]bool
+	Resources []string
+}
+
+func newDedupeSet() *dedupeSet {
+	return &dedupeSet{seen: make(map[string]bool)}
+}
+
+// add records target as pushed, returning true if it had not
+// already been pushed (i.e. the caller should proceed to push it).
+func (d *dedupeSet) add(target string) bool {
+	if d.seen[target] {
+		return false
+	}
+	d.seen[target] = true
+	d.Resources = append(d.Resources, target)
+	return true
+}
+
+// Interface guards
+var (
+	_ caddyhttp.MiddlewareHandler = (*Handler)(nil)
+	_ caddyhttp.HTTPInterfaces    = (*linkSniffResponseWriter)(nil)
+)
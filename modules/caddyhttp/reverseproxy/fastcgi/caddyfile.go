@@ -0,0 +1,315 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fastcgi
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig"
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp/reverseproxy"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp/rewrite"
+)
+
+func init() {
+	httpcaddyfile.RegisterDirective("php_fastcgi", parseCaddyfile)
+}
+
+// parseCaddyfile parses the php_fastcgi directive, a shortcut for a
+// reverse_proxy using the fastcgi transport, pre-configured the way
+// most PHP front-controller apps (WordPress, Laravel, etc.) expect:
+//
+//     php_fastcgi <upstream> {
+//         split        <ext>
+//         env          <key> <value>
+//         root         <path>
+//         index        <files...>
+//         dial_pool    <size>
+//         read_timeout <duration>
+//     }
+//
+// which is roughly equivalent to:
+//
+//     @phpFastCGIDotfiles path */.*
+//     respond @phpFastCGIDotfiles 404
+//
+//     @phpFastCGIDir path */
+//     rewrite @phpFastCGIDir {path}{file_path_when_request_path_ends_in_slash}
+//
+//     @phpFastCGIPretty not path *.* */
+//     rewrite @phpFastCGIPretty {path}/{file_path_when_request_path_has_no_extension}
+//
+//     reverse_proxy <upstream> {
+//         transport fastcgi {
+//             split <ext>
+//             env <key> <value>
+//             root <path>
+//             index <files...>
+//             dial_pool <size>
+//             read_timeout <duration>
+//         }
+//     }
+//
+func parseCaddyfile(h httpcaddyfile.Helper) ([]httpcaddyfile.ConfigValue, error) {
+	if !h.Next() {
+		return nil, h.ArgErr()
+	}
+
+	userMatcherSet, err := h.ExtractMatcherSet()
+	if err != nil {
+		return nil, err
+	}
+
+	dispenser := h.NewFromNextSegment()
+
+	transport := new(Transport)
+
+	// read our own subdirectives, deleting their tokens as we go so
+	// that the reverse_proxy unmarshaler (which doesn't know about
+	// them) never sees them
+	for dispenser.Next() {
+		for dispenser.NextBlock(0) && dispenser.Nesting() == 1 {
+			switch dispenser.Val() {
+			case "split":
+				if !dispenser.NextArg() {
+					return nil, dispenser.ArgErr()
+				}
+				transport.SplitPath = dispenser.Val()
+				dispenser.Delete()
+				dispenser.Delete()
+
+			case "root":
+				if !dispenser.NextArg() {
+					return nil, dispenser.ArgErr()
+				}
+				transport.Root = dispenser.Val()
+				dispenser.Delete()
+				dispenser.Delete()
+
+			case "index":
+				args := dispenser.RemainingArgs()
+				dispenser.Delete()
+				for range args {
+					dispenser.Delete()
+				}
+				if len(args) == 0 {
+					return nil, dispenser.ArgErr()
+				}
+				transport.IndexNames = args
+
+			case "env":
+				args := dispenser.RemainingArgs()
+				dispenser.Delete()
+				for range args {
+					dispenser.Delete()
+				}
+				if len(args) != 2 {
+					return nil, dispenser.ArgErr()
+				}
+				if transport.EnvVars == nil {
+					transport.EnvVars = make(map[string]string)
+				}
+				transport.EnvVars[args[0]] = args[1]
+
+			case "dial_pool":
+				if !dispenser.NextArg() {
+					return nil, dispenser.ArgErr()
+				}
+				size, convErr := strconv.Atoi(dispenser.Val())
+				if convErr != nil {
+					return nil, dispenser.Errf("parsing dial_pool: %v", convErr)
+				}
+				transport.DialPoolSize = size
+				dispenser.Delete()
+				dispenser.Delete()
+
+			case "read_timeout":
+				if !dispenser.NextArg() {
+					return nil, dispenser.ArgErr()
+				}
+				dur, convErr := time.ParseDuration(dispenser.Val())
+				if convErr != nil {
+					return nil, dispenser.Errf("parsing read_timeout: %v", convErr)
+				}
+				transport.ReadTimeout = caddy.Duration(dur)
+				dispenser.Delete()
+				dispenser.Delete()
+			}
+		}
+	}
+	dispenser.Reset()
+
+	if len(transport.IndexNames) == 0 {
+		transport.IndexNames = []string{"index.php"}
+	}
+
+	var routes []httpcaddyfile.ConfigValue
+
+	// deny access to dotfiles (.env, .htaccess, .git, etc.) -- PHP
+	// apps commonly ship these alongside the web root, and they
+	// should never be served or executed
+	dotfilePattern, _ := json.Marshal([]string{"*/.*"})
+	dotfileMatcher := caddy.ModuleMap{"path": dotfilePattern}
+	routes = append(routes, httpcaddyfile.ConfigValue{
+		Class: "route",
+		Value: caddyhttp.Route{
+			MatcherSetsRaw: []caddy.ModuleMap{mergeMatcherSet(dotfileMatcher, userMatcherSet)},
+			HandlersRaw: []json.RawMessage{caddyconfig.JSONModuleObject(
+				staticErrorResponder{StatusCode: "404"},
+				"handler",
+				"static_response",
+				nil,
+			)},
+		},
+	})
+
+	// try the configured index file(s) as a front controller when
+	// the request doesn't already name a PHP script, so pretty URLs
+	// like "/about" are routed to "index.php" the way Apache's
+	// mod_rewrite or nginx's try_files would. Two cases, so we don't
+	// double up the slash when the path already ends in one:
+	//
+	//   - the path already ends in "/" (e.g. "/", "/blog/"): append
+	//     the index name directly
+	//   - the path is a pretty URL with no trailing slash and no
+	//     file extension (e.g. "/about"): append "/" + the index name
+	indexName := transport.IndexNames[0]
+
+	dirPattern, _ := json.Marshal([]string{"*/"})
+	dirMatcher := caddy.ModuleMap{"path": dirPattern}
+	dirRewriteRoute := caddyhttp.Route{
+		MatcherSetsRaw: []caddy.ModuleMap{mergeMatcherSet(dirMatcher, userMatcherSet)},
+		HandlersRaw: []json.RawMessage{caddyconfig.JSONModuleObject(
+			&rewrite.Rewrite{URI: "{http.request.uri.path}" + indexName},
+			"handler",
+			"rewrite",
+			nil,
+		)},
+	}
+	routes = append(routes, httpcaddyfile.ConfigValue{Class: "route", Value: dirRewriteRoute})
+
+	notDirOrFilePattern, _ := json.Marshal([]string{"*.*", "*/"})
+	notDirOrFileMatcher, _ := json.Marshal([]caddy.ModuleMap{{"path": notDirOrFilePattern}})
+	prettyURLMatcher := caddy.ModuleMap{"not": notDirOrFileMatcher}
+	prettyURLRewriteRoute := caddyhttp.Route{
+		MatcherSetsRaw: []caddy.ModuleMap{mergeMatcherSet(prettyURLMatcher, userMatcherSet)},
+		HandlersRaw: []json.RawMessage{caddyconfig.JSONModuleObject(
+			&rewrite.Rewrite{URI: "{http.request.uri.path}/" + indexName},
+			"handler",
+			"rewrite",
+			nil,
+		)},
+	}
+	routes = append(routes, httpcaddyfile.ConfigValue{Class: "route", Value: prettyURLRewriteRoute})
+
+	// the reverse_proxy itself, using our fastcgi transport
+	rpHandler := &reverseproxy.Handler{}
+	if err := rpHandler.UnmarshalCaddyfile(dispenser); err != nil {
+		return nil, err
+	}
+	if err := rpHandler.FinalizeUnmarshalCaddyfile(h); err != nil {
+		return nil, err
+	}
+	rpHandler.TransportRaw = caddyconfig.JSONModuleObject(transport, "protocol", "fastcgi", nil)
+
+	rpRoute := caddyhttp.Route{
+		HandlersRaw: []json.RawMessage{caddyconfig.JSONModuleObject(
+			rpHandler,
+			"handler",
+			"reverse_proxy",
+			nil,
+		)},
+	}
+	if userMatcherSet != nil {
+		rpRoute.MatcherSetsRaw = []caddy.ModuleMap{userMatcherSet}
+	}
+	routes = append(routes, httpcaddyfile.ConfigValue{Class: "route", Value: rpRoute})
+
+	return routes, nil
+}
+
+// mergeMatcherSet ANDs userMatcherSet into matcherSet (matchers
+// within the same caddy.ModuleMap are ANDed together), so that a
+// user-supplied matcher on the php_fastcgi directive itself (e.g.
+// "php_fastcgi @matcher localhost:9000") scopes every route this
+// directive generates, not just the reverse_proxy one. userMatcherSet
+// may be nil, in which case matcherSet is returned unchanged.
+//
+// matcherSet and userMatcherSet are keyed by matcher module name
+// (e.g. "path"), so a plain map merge would let a user matcher of
+// the same type we generate internally (most plausibly "path")
+// silently overwrite ours instead of being ANDed with it. When a key
+// collides like that, both sides are combined via De Morgan's law
+// (A AND B == NOT(NOT A OR NOT B)) using the "not" matcher, since
+// there is no "and" matcher module in this registry.
+func mergeMatcherSet(matcherSet, userMatcherSet caddy.ModuleMap) caddy.ModuleMap {
+	if userMatcherSet == nil {
+		return matcherSet
+	}
+	merged := make(caddy.ModuleMap, len(matcherSet)+len(userMatcherSet))
+	var conflicts []caddy.ModuleMap
+	for k, v := range matcherSet {
+		if uv, ok := userMatcherSet[k]; ok {
+			conflicts = append(conflicts, caddy.ModuleMap{k: v}, caddy.ModuleMap{k: uv})
+			continue
+		}
+		merged[k] = v
+	}
+	for k, v := range userMatcherSet {
+		if _, ok := matcherSet[k]; ok {
+			continue // already combined into conflicts above
+		}
+		merged[k] = v
+	}
+	if len(conflicts) > 0 {
+		merged["not"] = andOfNotJSON(conflicts)
+	}
+	return merged
+}
+
+// andOfNotJSON builds the JSON for a "not" matcher whose match sets
+// are themselves negations of each matcher set in sets, so that the
+// whole thing ANDs all of sets together: NOT(NOT set1 OR NOT set2
+// OR ...) == set1 AND set2 AND ... This is how mergeMatcherSet ANDs
+// two matchers of the same type without an "and" matcher module.
+func andOfNotJSON(sets []caddy.ModuleMap) json.RawMessage {
+	notSets := make([]caddy.ModuleMap, len(sets))
+	for i, set := range sets {
+		inner, err := json.Marshal([]caddy.ModuleMap{set})
+		if err != nil {
+			// set is built entirely from values that were already
+			// successfully marshaled json.RawMessage, so
+			// re-marshaling them can't actually fail
+			panic(err)
+		}
+		notSets[i] = caddy.ModuleMap{"not": inner}
+	}
+	raw, err := json.Marshal(notSets)
+	if err != nil {
+		panic(err)
+	}
+	return raw
+}
+
+// staticErrorResponder is the minimal shape of the built-in
+// static_response handler needed to respond with a bare status
+// code, e.g. for denying access to dotfiles.
+type staticErrorResponder struct {
+	StatusCode string `json:"status_code,omitempty"`
+}
@@ -0,0 +1,88 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fastcgi
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2"
+)
+
+func TestMergeMatcherSetNoConflict(t *testing.T) {
+	matcherSet := caddy.ModuleMap{"not": json.RawMessage(`[{"path":["*.php"]}]`)}
+	userMatcherSet := caddy.ModuleMap{"host": json.RawMessage(`["example.com"]`)}
+
+	merged := mergeMatcherSet(matcherSet, userMatcherSet)
+
+	if len(merged) != 2 {
+		t.Fatalf("expected 2 keys in merged matcher set, got %d: %v", len(merged), merged)
+	}
+	if _, ok := merged["not"]; !ok {
+		t.Error("expected merged matcher set to keep the internally-generated \"not\" matcher")
+	}
+	if _, ok := merged["host"]; !ok {
+		t.Error("expected merged matcher set to keep the user-supplied \"host\" matcher")
+	}
+}
+
+func TestMergeMatcherSetCollision(t *testing.T) {
+	matcherSet := caddy.ModuleMap{"path": json.RawMessage(`["*.php"]`)}
+	userMatcherSet := caddy.ModuleMap{"path": json.RawMessage(`["/app/*"]`)}
+
+	merged := mergeMatcherSet(matcherSet, userMatcherSet)
+
+	if len(merged) != 1 {
+		t.Fatalf("expected the colliding \"path\" key to be combined into a single \"not\" matcher, got %v", merged)
+	}
+	notRaw, ok := merged["not"]
+	if !ok {
+		t.Fatalf("expected collision to be ANDed together via a \"not\" matcher, got %v", merged)
+	}
+
+	var notSets []caddy.ModuleMap
+	if err := json.Unmarshal(notRaw, &notSets); err != nil {
+		t.Fatalf("unmarshaling \"not\" matcher sets: %v", err)
+	}
+	if len(notSets) != 2 {
+		t.Fatalf("expected 2 negated sets (one per side of the collision), got %d", len(notSets))
+	}
+	for _, set := range notSets {
+		innerRaw, ok := set["not"]
+		if !ok {
+			t.Fatalf("expected each entry to itself be a \"not\" matcher (De Morgan's law), got %v", set)
+		}
+		var inner []caddy.ModuleMap
+		if err := json.Unmarshal(innerRaw, &inner); err != nil {
+			t.Fatalf("unmarshaling inner \"not\" set: %v", err)
+		}
+		if len(inner) != 1 {
+			t.Fatalf("expected exactly 1 matcher set inside the inner \"not\", got %d", len(inner))
+		}
+		if _, ok := inner[0]["path"]; !ok {
+			t.Errorf("expected inner negated set to contain the colliding \"path\" matcher, got %v", inner[0])
+		}
+	}
+}
+
+func TestMergeMatcherSetNilUser(t *testing.T) {
+	matcherSet := caddy.ModuleMap{"path": json.RawMessage(`["*.php"]`)}
+
+	merged := mergeMatcherSet(matcherSet, nil)
+
+	if len(merged) != 1 {
+		t.Fatalf("expected matcherSet to be returned unchanged when userMatcherSet is nil, got %v", merged)
+	}
+}
@@ -0,0 +1,326 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fastcgi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FastCGI protocol constants, per the FastCGI 1.0 specification.
+const (
+	fcgiVersion1 = 1
+
+	typeBeginRequest = 1
+	typeAbortRequest = 2
+	typeEndRequest   = 3
+	typeParams       = 4
+	typeStdin        = 5
+	typeStdout       = 6
+	typeStderr       = 7
+
+	roleResponder = 1
+
+	maxWrite = 65535 // max content length of a single FastCGI record
+)
+
+// client speaks the FastCGI protocol over a single connection. It
+// is not safe for concurrent use; callers (or a connPool) must
+// serialize access to a given client.
+type client struct {
+	conn      net.Conn
+	reqID     uint16
+	idleSince time.Time
+}
+
+func newClient(conn net.Conn) *client {
+	return &client{conn: conn, reqID: 1}
+}
+
+func dial(network, address string, timeout time.Duration) (net.Conn, error) {
+	return net.DialTimeout(network, address, timeout)
+}
+
+// Close closes the underlying connection.
+func (c *client) Close() error {
+	return c.conn.Close()
+}
+
+// Do sends env and body (if non-nil) to the FastCGI application as
+// a single responder request, and returns the HTTP response built
+// from its output.
+func (c *client) Do(env map[string]string, body io.Reader, readTimeout time.Duration) (*http.Response, error) {
+	if readTimeout > 0 {
+		_ = c.conn.SetDeadline(time.Now().Add(readTimeout))
+	}
+
+	if err := c.writeBeginRequest(); err != nil {
+		return nil, err
+	}
+	if err := c.writeParams(env); err != nil {
+		return nil, err
+	}
+	if err := c.writeStdin(body); err != nil {
+		return nil, err
+	}
+
+	return c.readResponse()
+}
+
+func (c *client) writeBeginRequest() error {
+	content := make([]byte, 8)
+	binary.BigEndian.PutUint16(content[0:2], roleResponder)
+	content[2] = 1 // keep connection open (FCGI_KEEP_CONN)
+	return c.writeRecord(typeBeginRequest, content)
+}
+
+func (c *client) writeParams(env map[string]string) error {
+	var buf bytes.Buffer
+	for k, v := range env {
+		writeLenPair(&buf, len(k), len(v))
+		buf.WriteString(k)
+		buf.WriteString(v)
+	}
+	if err := c.writeStream(typeParams, &buf); err != nil {
+		return err
+	}
+	// empty record signals end of the params stream
+	return c.writeRecord(typeParams, nil)
+}
+
+func (c *client) writeStdin(body io.Reader) error {
+	if body != nil {
+		if err := c.writeStream(typeStdin, body); err != nil {
+			return err
+		}
+	}
+	// empty record signals end of the stdin stream
+	return c.writeRecord(typeStdin, nil)
+}
+
+// writeStream splits r's content across as many maxWrite-sized
+// records as necessary.
+func (c *client) writeStream(recType uint8, r io.Reader) error {
+	buf := make([]byte, maxWrite)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if werr := c.writeRecord(recType, buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (c *client) writeRecord(recType uint8, content []byte) error {
+	padding := (8 - len(content)%8) % 8
+	header := [8]byte{
+		0: fcgiVersion1,
+		1: recType,
+	}
+	binary.BigEndian.PutUint16(header[2:4], c.reqID)
+	binary.BigEndian.PutUint16(header[4:6], uint16(len(content)))
+	header[6] = byte(padding)
+
+	if _, err := c.conn.Write(header[:]); err != nil {
+		return err
+	}
+	if len(content) > 0 {
+		if _, err := c.conn.Write(content); err != nil {
+			return err
+		}
+	}
+	if padding > 0 {
+		if _, err := c.conn.Write(make([]byte, padding)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeLenPair encodes a FastCGI name-value length, using the
+// short (1-byte) form when it fits in 7 bits, else the long
+// (4-byte) form with the high bit set, per the spec.
+func writeLenPair(buf *bytes.Buffer, nameLen, valLen int) {
+	writeLen(buf, nameLen)
+	writeLen(buf, valLen)
+}
+
+func writeLen(buf *bytes.Buffer, l int) {
+	if l <= 127 {
+		buf.WriteByte(byte(l))
+		return
+	}
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(l))
+	b[0] |= 0x80
+	buf.Write(b[:])
+}
+
+// readResponse reads and demultiplexes stdout/stderr records until
+// it sees FCGI_END_REQUEST, then parses the CGI-style response
+// headers out of the accumulated stdout stream.
+func (c *client) readResponse() (*http.Response, error) {
+	var stdout, stderr bytes.Buffer
+	r := bufio.NewReader(c.conn)
+
+	for {
+		var hdr [8]byte
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return nil, fmt.Errorf("reading record header: %w", err)
+		}
+		recType := hdr[1]
+		contentLen := binary.BigEndian.Uint16(hdr[4:6])
+		padding := hdr[6]
+
+		content := make([]byte, contentLen)
+		if _, err := io.ReadFull(r, content); err != nil {
+			return nil, fmt.Errorf("reading record content: %w", err)
+		}
+		if padding > 0 {
+			if _, err := io.CopyN(ioutil.Discard, r, int64(padding)); err != nil {
+				return nil, err
+			}
+		}
+
+		switch recType {
+		case typeStdout:
+			stdout.Write(content)
+		case typeStderr:
+			stderr.Write(content)
+		case typeEndRequest:
+			return parseResponse(stdout.Bytes(), stderr.Bytes())
+		}
+	}
+}
+
+// parseResponse parses a raw FastCGI stdout stream, which consists
+// of CGI-style "Header: value" lines followed by a blank line and
+// then the response body, into an *http.Response.
+func parseResponse(stdout, stderr []byte) (*http.Response, error) {
+	tp := textproto.NewReader(bufio.NewReader(bytes.NewReader(stdout)))
+	mimeHeader, err := tp.ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("reading CGI headers: %w", err)
+	}
+
+	header := http.Header(mimeHeader)
+
+	status := http.StatusOK
+	if statusLine := header.Get("Status"); statusLine != "" {
+		header.Del("Status")
+		if code, convErr := strconv.Atoi(strings.Fields(statusLine)[0]); convErr == nil {
+			status = code
+		}
+	}
+
+	remainder, _ := ioutil.ReadAll(tp.R)
+
+	resp := &http.Response{
+		StatusCode: status,
+		Status:     fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		Header:     header,
+		Body:       ioutil.NopCloser(bytes.NewReader(remainder)),
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+	}
+	if len(stderr) > 0 {
+		resp.Header.Set("X-FastCGI-Stderr", string(stderr))
+	}
+	return resp, nil
+}
+
+// parseAddress splits a reverse_proxy upstream address into the
+// network and address to dial, supporting Unix sockets (addresses
+// beginning with "unix/" or ending in ".sock") in addition to the
+// usual host:port form.
+func parseAddress(addr string) (network, address string) {
+	if strings.HasPrefix(addr, "unix/") {
+		return "unix", strings.TrimPrefix(addr, "unix/")
+	}
+	if strings.HasSuffix(addr, ".sock") {
+		return "unix", addr
+	}
+	return "tcp", addr
+}
+
+// connPool is a small, bounded pool of persistent FastCGI
+// connections keyed by upstream address, analogous to the v1
+// persistentDialer. Idle connections are evicted after maxIdle.
+type connPool struct {
+	mu      sync.Mutex
+	size    int
+	maxIdle time.Duration
+	conns   map[string][]*client
+}
+
+func newConnPool(size int, maxIdle time.Duration) *connPool {
+	return &connPool{
+		size:    size,
+		maxIdle: maxIdle,
+		conns:   make(map[string][]*client),
+	}
+}
+
+// get returns a still-fresh pooled connection for address, if any.
+func (p *connPool) get(address string) (*client, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pooled := p.conns[address]
+	for len(pooled) > 0 {
+		c := pooled[len(pooled)-1]
+		pooled = pooled[:len(pooled)-1]
+		p.conns[address] = pooled
+		if time.Since(c.idleSince) > p.maxIdle {
+			c.Close()
+			continue
+		}
+		return c, true
+	}
+	return nil, false
+}
+
+// put returns c to the pool for address, closing it instead if the
+// pool for that address is already at capacity.
+func (p *connPool) put(address string, c *client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.conns[address]) >= p.size {
+		c.Close()
+		return
+	}
+	c.idleSince = time.Now()
+	p.conns[address] = append(p.conns[address], c)
+}
@@ -0,0 +1,315 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fastcgi implements a FastCGI transport for Caddy's
+// reverse_proxy, so that FastCGI application servers (most commonly
+// PHP-FPM) can be proxied to with the same upstream selection, load
+// balancing, and health-checking machinery as any other backend.
+package fastcgi
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+func init() {
+	caddy.RegisterModule(Transport{})
+}
+
+// Transport facilitates FastCGI communication, the way a
+// reverseproxy's Transport normally facilitates HTTP communication,
+// but with an application server such as PHP-FPM instead of an HTTP
+// server.
+type Transport struct {
+	// Root is the fake document root to send to the FastCGI
+	// application, required so it can find the script file named
+	// by the request.
+	Root string `json:"root,omitempty"`
+
+	// SplitPath separates the path from any extra trailing path
+	// info, e.g. ".php" will split "/index.php/foo" into script
+	// name "/index.php" and path info "/foo".
+	SplitPath string `json:"split_path,omitempty"`
+
+	// IndexNames are file names for front-controller-style routing
+	// when the request path ends in a slash. Only the first name is
+	// appended to the path; the others are not tried.
+	IndexNames []string `json:"index_names,omitempty"`
+
+	// EnvVars are extra environment variables to send to the
+	// FastCGI application for every request.
+	EnvVars map[string]string `json:"env,omitempty"`
+
+	// DialTimeout is how long to wait to connect to the FastCGI
+	// server before giving up.
+	DialTimeout caddy.Duration `json:"dial_timeout,omitempty"`
+
+	// ReadTimeout is how long to wait for the FastCGI server to
+	// send the response before giving up.
+	ReadTimeout caddy.Duration `json:"read_timeout,omitempty"`
+
+	// DialPoolSize is the maximum number of idle, persistent
+	// connections to keep open per FastCGI address, analogous to
+	// the v1 "pool" subdirective. If zero, a new connection is
+	// dialed (and closed) for every request.
+	DialPoolSize int `json:"dial_pool,omitempty"`
+
+	pool *connPool
+}
+
+// CaddyModule returns the Caddy module information.
+func (Transport) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.reverse_proxy.transport.fastcgi",
+		New: func() caddy.Module { return new(Transport) },
+	}
+}
+
+// Provision sets up t.
+func (t *Transport) Provision(_ caddy.Context) error {
+	if len(t.IndexNames) == 0 {
+		t.IndexNames = []string{"index.php"}
+	}
+	if t.DialPoolSize > 0 {
+		t.pool = newConnPool(t.DialPoolSize, 2*time.Minute)
+	}
+	return nil
+}
+
+// RoundTrip implements http.RoundTripper, dialing (or reusing a
+// pooled connection to) the FastCGI application named by
+// req.URL.Host, forwarding the request as FastCGI params/stdin, and
+// translating the application's response into an *http.Response.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	network, address := parseAddress(req.URL.Host)
+
+	var c *client
+	var pooled bool
+	if t.pool != nil {
+		if conn, ok := t.pool.get(address); ok {
+			c = conn
+			pooled = true
+		}
+	}
+	if c == nil {
+		timeout := time.Duration(t.DialTimeout)
+		if timeout == 0 {
+			timeout = 3 * time.Second
+		}
+		conn, err := dial(network, address, timeout)
+		if err != nil {
+			return nil, err
+		}
+		c = newClient(conn)
+	}
+
+	env, err := t.buildEnv(req)
+	if err != nil {
+		if !pooled {
+			c.Close()
+		}
+		return nil, err
+	}
+
+	readTimeout := time.Duration(t.ReadTimeout)
+	resp, err := c.Do(env, req.Body, readTimeout)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	if t.pool != nil {
+		t.pool.put(address, c)
+	} else {
+		// close once the caller is done reading the body
+		resp.Body = closeWrapper{resp.Body, c}
+	}
+
+	return resp, nil
+}
+
+// buildEnv constructs the CGI/FastCGI environment variables that
+// describe req to the application, analogous to what a normal CGI
+// or FastCGI web server would set.
+func (t *Transport) buildEnv(req *http.Request) (map[string]string, error) {
+	docRoot := t.Root
+	if docRoot == "" {
+		docRoot = "."
+	}
+
+	reqPath := req.URL.Path
+	scriptName, pathInfo := reqPath, ""
+	if t.SplitPath != "" {
+		if idx := strings.Index(reqPath, t.SplitPath); idx > -1 {
+			splitPos := idx + len(t.SplitPath)
+			scriptName, pathInfo = reqPath[:splitPos], reqPath[splitPos:]
+		}
+	}
+	if strings.HasSuffix(scriptName, "/") {
+		for _, index := range t.IndexNames {
+			scriptName = path.Join(scriptName, index)
+			break
+		}
+	}
+
+	scriptFilename := path.Join(docRoot, scriptName)
+
+	env := map[string]string{
+		"SCRIPT_FILENAME":   scriptFilename,
+		"SCRIPT_NAME":       scriptName,
+		"DOCUMENT_ROOT":     docRoot,
+		"PATH_INFO":         pathInfo,
+		"REQUEST_METHOD":    req.Method,
+		"REQUEST_URI":       req.URL.RequestURI(),
+		"QUERY_STRING":      req.URL.RawQuery,
+		"SERVER_PROTOCOL":   req.Proto,
+		"HTTP_HOST":         req.Host,
+		"CONTENT_TYPE":      req.Header.Get("Content-Type"),
+		"GATEWAY_INTERFACE": "CGI/1.1",
+		"SERVER_SOFTWARE":   "Caddy",
+	}
+	// req.ContentLength is -1 when the body's length isn't known
+	// up front (e.g. chunked transfer encoding); per the CGI spec,
+	// CONTENT_LENGTH should be omitted in that case rather than set
+	// to a nonsensical negative value.
+	if req.ContentLength >= 0 {
+		env["CONTENT_LENGTH"] = strconv.FormatInt(req.ContentLength, 10)
+	}
+	if req.TLS != nil {
+		env["HTTPS"] = "on"
+	}
+	for name, vals := range req.Header {
+		key := "HTTP_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+		env[key] = strings.Join(vals, ", ")
+	}
+	for k, v := range t.EnvVars {
+		env[k] = v
+	}
+
+	return env, nil
+}
+
+// UnmarshalCaddyfile sets up the transport from Caddyfile tokens. Syntax:
+//
+//     transport fastcgi {
+//         root         <path>
+//         split        <at>
+//         index        <files...>
+//         env          <key> <value>
+//         dial_timeout <duration>
+//         read_timeout <duration>
+//         dial_pool    <size>
+//     }
+//
+func (t *Transport) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		for d.NextBlock(0) {
+			switch d.Val() {
+			case "root":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				t.Root = d.Val()
+
+			case "split":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				t.SplitPath = d.Val()
+
+			case "index":
+				args := d.RemainingArgs()
+				if len(args) == 0 {
+					return d.ArgErr()
+				}
+				t.IndexNames = args
+
+			case "env":
+				args := d.RemainingArgs()
+				if len(args) != 2 {
+					return d.ArgErr()
+				}
+				if t.EnvVars == nil {
+					t.EnvVars = make(map[string]string)
+				}
+				t.EnvVars[args[0]] = args[1]
+
+			case "dial_timeout":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				dur, err := time.ParseDuration(d.Val())
+				if err != nil {
+					return d.Errf("parsing dial_timeout: %v", err)
+				}
+				t.DialTimeout = caddy.Duration(dur)
+
+			case "read_timeout":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				dur, err := time.ParseDuration(d.Val())
+				if err != nil {
+					return d.Errf("parsing read_timeout: %v", err)
+				}
+				t.ReadTimeout = caddy.Duration(dur)
+
+			case "dial_pool":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				size, err := strconv.Atoi(d.Val())
+				if err != nil {
+					return d.Errf("parsing dial_pool: %v", err)
+				}
+				t.DialPoolSize = size
+
+			default:
+				return d.Errf("unrecognized subdirective: %s", d.Val())
+			}
+		}
+	}
+	return nil
+}
+
+// closeWrapper closes c once the wrapped body has been fully read
+// and closed, for the non-pooled (dial-per-request) code path.
+type closeWrapper struct {
+	body interface {
+		Read([]byte) (int, error)
+		Close() error
+	}
+	c *client
+}
+
+func (cw closeWrapper) Read(p []byte) (int, error) { return cw.body.Read(p) }
+
+func (cw closeWrapper) Close() error {
+	err := cw.body.Close()
+	cw.c.Close()
+	return err
+}
+
+// Interface guards
+var (
+	_ http.RoundTripper     = (*Transport)(nil)
+	_ caddy.Provisioner     = (*Transport)(nil)
+	_ caddyfile.Unmarshaler = (*Transport)(nil)
+)
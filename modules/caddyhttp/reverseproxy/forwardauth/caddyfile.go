@@ -17,6 +17,7 @@ package forwardauth
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig"
@@ -42,6 +43,13 @@ func init() {
 //         copy_headers Remote-User Remote-Email
 //     }
 //
+// The copy_headers subdirective also accepts a "src>dst" syntax per argument,
+// which renames the header as it is copied onto the original request; this is
+// useful when the upstream app expects a different header name than what the
+// auth gateway emits:
+//
+//     copy_headers Remote-User>X-Auth-User Remote-Groups>X-Auth-Groups
+//
 // is equivalent to a reverse_proxy directive like this:
 //
 //     reverse_proxy auth-gateway:9091 {
@@ -114,8 +122,11 @@ func parseCaddyfile(h httpcaddyfile.Helper) ([]httpcaddyfile.ConfigValue, error)
 
 	// collect the headers to copy from the auth response
 	// onto the original request, so they can get passed
-	// through to a backend app
-	headersToCopy := []string{}
+	// through to a backend app; the map is keyed by the
+	// destination header name and valued by the source
+	// header name on the auth response (usually the same,
+	// unless the "src>dst" syntax was used to rename it)
+	headersToCopy := map[string]string{}
 
 	// read the subdirectives for configuring the forward_auth shortcut
 	// NOTE: we delete the tokens as we go so that the reverse_proxy
@@ -136,7 +147,11 @@ func parseCaddyfile(h httpcaddyfile.Helper) ([]httpcaddyfile.ConfigValue, error)
 				dispenser.Delete()
 				for _, headerField := range args {
 					dispenser.Delete()
-					headersToCopy = append(headersToCopy, headerField)
+					src, dst := headerField, headerField
+					if idx := strings.Index(headerField, ">"); idx > -1 {
+						src, dst = headerField[:idx], headerField[idx+1:]
+					}
+					headersToCopy[dst] = src
 				}
 				if len(headersToCopy) == 0 {
 					return nil, dispenser.ArgErr()
@@ -172,9 +187,9 @@ func parseCaddyfile(h httpcaddyfile.Helper) ([]httpcaddyfile.ConfigValue, error)
 			},
 		}
 
-		for _, headerField := range headersToCopy {
-			handler.Request.Set[headerField] = []string{
-				"{http.reverse_proxy.header." + headerField + "}",
+		for dst, src := range headersToCopy {
+			handler.Request.Set[dst] = []string{
+				"{http.reverse_proxy.header." + src + "}",
 			}
 		}
 
@@ -15,9 +15,14 @@
 package caddyhttp
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
+	"text/template"
 
 	"github.com/caddyserver/caddy/v2"
 )
@@ -27,9 +32,45 @@ func init() {
 }
 
 // StaticError implements a simple handler that returns an error.
+// By default, the response is a plain text message derived from
+// Error and StatusCode, just like before; optionally, Responses
+// can configure a templated, content-negotiated body and Headers
+// can set arbitrary response headers, which turns this handler
+// into a general-purpose error page/response subsystem.
 type StaticError struct {
 	Error      string     `json:"error,omitempty"`
 	StatusCode WeakString `json:"status_code,omitempty"`
+
+	// Responses configures a custom response body for specific
+	// status codes, keyed by the numeric status code as a string
+	// (e.g. "404"). If the effective status code (after evaluating
+	// StatusCode) has an entry here, it is used instead of the
+	// plain-text Error fallback.
+	Responses map[string]*ErrorResponseBody `json:"responses,omitempty"`
+
+	// Headers are added to the response, regardless of whether a
+	// custom body from Responses is used. Useful for things like
+	// Retry-After or WWW-Authenticate.
+	Headers http.Header `json:"headers,omitempty"`
+}
+
+// ErrorResponseBody configures a single custom error response
+// body. Exactly one of Body (an inline string) or BodyFile (a
+// path to read the template from) should be set. The content is
+// first expanded with the Caddy replacer, then parsed and executed
+// as a Go template with access to the fields of errorTemplateData,
+// i.e. `{{.Req}}`, `{{.Err}}`, and `{{.StatusCode}}`.
+type ErrorResponseBody struct {
+	Body     string `json:"body,omitempty"`
+	BodyFile string `json:"body_file,omitempty"`
+}
+
+// errorTemplateData is made available to an ErrorResponseBody
+// template.
+type errorTemplateData struct {
+	Req        *http.Request
+	Err        error
+	StatusCode int
 }
 
 // CaddyModule returns the Caddy module information.
@@ -52,7 +93,103 @@ func (e StaticError) ServeHTTP(w http.ResponseWriter, r *http.Request, _ Handler
 		statusCode = intVal
 	}
 
-	return Error(statusCode, fmt.Errorf("%s", e.Error))
+	var handlerErr error
+	if e.Error != "" {
+		handlerErr = fmt.Errorf("%s", e.Error)
+	}
+
+	for field, vals := range e.Headers {
+		for _, v := range vals {
+			w.Header().Add(field, repl.ReplaceAll(v, ""))
+		}
+	}
+
+	resp := e.Responses[strconv.Itoa(statusCode)]
+	if resp == nil {
+		return Error(statusCode, handlerErr)
+	}
+
+	body, err := resp.render(repl, errorTemplateData{
+		Req:        r,
+		Err:        handlerErr,
+		StatusCode: statusCode,
+	})
+	if err != nil {
+		return Error(http.StatusInternalServerError, err)
+	}
+
+	contentType := negotiateErrorContentType(r)
+	if contentType == jsonErrorContentType && !json.Valid(body) {
+		// the admin's template rendered plain text or HTML, not JSON,
+		// so wrap it in a minimal JSON envelope. If it already rendered
+		// valid JSON (e.g. a body tailored for this status code),
+		// leave it as-is instead of double-encoding it as a string.
+		body, err = json.Marshal(struct {
+			Error      string `json:"error,omitempty"`
+			StatusCode int    `json:"status_code"`
+		}{
+			Error:      string(body),
+			StatusCode: statusCode,
+		})
+		if err != nil {
+			return Error(http.StatusInternalServerError, err)
+		}
+	}
+
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", contentType)
+	}
+
+	w.WriteHeader(statusCode)
+	w.Write(body)
+
+	return nil
+}
+
+// render reads the body (from BodyFile, if set), expands Caddy
+// placeholders, then parses and executes it as a Go template
+// against data.
+func (erb ErrorResponseBody) render(repl caddy.Replacer, data errorTemplateData) ([]byte, error) {
+	tplText := erb.Body
+	if erb.BodyFile != "" {
+		fileBytes, err := ioutil.ReadFile(repl.ReplaceAll(erb.BodyFile, ""))
+		if err != nil {
+			return nil, err
+		}
+		tplText = string(fileBytes)
+	}
+	tplText = repl.ReplaceAll(tplText, "")
+
+	tpl, err := template.New("error_response").Parse(tplText)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+const jsonErrorContentType = "application/json; charset=utf-8"
+
+// negotiateErrorContentType picks a Content-Type for an error
+// response based on the request's Accept header, preferring JSON
+// or HTML when the client asks for them and falling back to plain
+// text otherwise. When it picks jsonErrorContentType, the caller
+// wraps the rendered body in a JSON envelope unless the template
+// already rendered valid JSON.
+func negotiateErrorContentType(r *http.Request) string {
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "application/json"):
+		return jsonErrorContentType
+	case strings.Contains(accept, "text/html"):
+		return "text/html; charset=utf-8"
+	default:
+		return "text/plain; charset=utf-8"
+	}
 }
 
 // Interface guard
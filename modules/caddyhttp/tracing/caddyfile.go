@@ -0,0 +1,80 @@
+package tracing
+
+import (
+	"strconv"
+
+	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+)
+
+func init() {
+	httpcaddyfile.RegisterHandlerDirective("tracing", parseCaddyfile)
+}
+
+// parseCaddyfile parses the tracing directive. Syntax:
+//
+//     tracing {
+//         span <name>
+//         attribute <name> <value>
+//         sampler {
+//             type  <always|never|ratio|parent_based>
+//             ratio <fraction>
+//         }
+//     }
+//
+func parseCaddyfile(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error) {
+	t := new(Tracing)
+
+	for h.Next() {
+		for h.NextBlock(0) {
+			switch h.Val() {
+			case "span":
+				if !h.NextArg() {
+					return nil, h.ArgErr()
+				}
+				t.SpanName = h.Val()
+
+			case "attribute":
+				args := h.RemainingArgs()
+				if len(args) != 2 {
+					return nil, h.ArgErr()
+				}
+				if t.Attributes == nil {
+					t.Attributes = make(map[string]string)
+				}
+				t.Attributes[args[0]] = args[1]
+
+			case "sampler":
+				sampler := new(SamplerConfig)
+				for h.NextBlock(1) {
+					switch h.Val() {
+					case "type":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						sampler.Type = h.Val()
+
+					case "ratio":
+						if !h.NextArg() {
+							return nil, h.ArgErr()
+						}
+						ratio, err := strconv.ParseFloat(h.Val(), 64)
+						if err != nil {
+							return nil, h.Errf("parsing sampler ratio: %v", err)
+						}
+						sampler.Ratio = ratio
+
+					default:
+						return nil, h.Errf("unrecognized sampler subdirective: %s", h.Val())
+					}
+				}
+				t.Sampler = sampler
+
+			default:
+				return nil, h.Errf("unrecognized subdirective: %s", h.Val())
+			}
+		}
+	}
+
+	return t, nil
+}
@@ -0,0 +1,93 @@
+package tracing
+
+import (
+	"net/http"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(Tracing{})
+}
+
+// Tracing implements OpenTelemetry tracing. If enabled, incoming
+// requests are traced, and the tracing context is propagated to
+// upstreams through the configured transport, to the extent it
+// supports it.
+type Tracing struct {
+	// SpanName is the span name to use for the displayed traces.
+	// This defaults to "handler".
+	SpanName string `json:"span_name,omitempty"`
+
+	// Attributes are extra attributes to set on every span, keyed by
+	// attribute name and valued by a string that may contain Caddy
+	// placeholders, expanded per-request.
+	Attributes map[string]string `json:"attributes,omitempty"`
+
+	// Sampler configures which requests are sampled, i.e. actually
+	// traced and exported. By default every request is sampled.
+	Sampler *SamplerConfig `json:"sampler,omitempty"`
+
+	ot     openTelemetryWrapper
+	logger *zap.Logger
+}
+
+// SamplerConfig configures an OpenTelemetry sampler.
+type SamplerConfig struct {
+	// Type is the kind of sampler to use: "always" (the default),
+	// "never", "ratio", or "parent_based".
+	Type string `json:"type,omitempty"`
+
+	// Ratio is the sampling ratio used by the "ratio" and
+	// "parent_based" sampler types, between 0 and 1.
+	Ratio float64 `json:"ratio,omitempty"`
+}
+
+// CaddyModule returns the Caddy module information.
+func (Tracing) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.tracing",
+		New: func() caddy.Module { return new(Tracing) },
+	}
+}
+
+// Provision sets up the tracing handler.
+func (t *Tracing) Provision(ctx caddy.Context) error {
+	t.logger = ctx.Logger(t)
+
+	kind, ratio := "", 0.0
+	if t.Sampler != nil {
+		kind, ratio = t.Sampler.Type, t.Sampler.Ratio
+	}
+	sampler, err := buildSampler(kind, ratio)
+	if err != nil {
+		return err
+	}
+
+	ot, err := newOpenTelemetryWrapper(ctx, t.SpanName, t.Attributes, sampler)
+	if err != nil {
+		return err
+	}
+	t.ot = ot
+
+	return nil
+}
+
+// ServeHTTP implements caddyhttp.MiddlewareHandler.
+func (t *Tracing) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	return t.ot.ServeHTTP(w, r, next)
+}
+
+// Cleanup implements caddy.CleanerUpper.
+func (t *Tracing) Cleanup() error {
+	return t.ot.cleanup(t.logger)
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner           = (*Tracing)(nil)
+	_ caddy.CleanerUpper          = (*Tracing)(nil)
+	_ caddyhttp.MiddlewareHandler = (*Tracing)(nil)
+)
@@ -3,16 +3,20 @@ package tracing
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 
+	"github.com/caddyserver/caddy/v2"
 	caddycmd "github.com/caddyserver/caddy/v2/cmd"
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -28,19 +32,28 @@ type openTelemetryWrapper struct {
 	handler http.Handler
 
 	spanName string
+
+	// attributes are extra span attributes to set on every request,
+	// keyed by attribute name and valued by a string that may
+	// contain Caddy placeholders (e.g. "{http.request.header.X-User}"),
+	// expanded per-request before being attached to the span.
+	attributes map[string]string
 }
 
 // newOpenTelemetryWrapper is responsible for the openTelemetryWrapper initialization using provided configuration.
 func newOpenTelemetryWrapper(
 	ctx context.Context,
 	spanName string,
+	attributes map[string]string,
+	sampler sdktrace.Sampler,
 ) (openTelemetryWrapper, error) {
 	if spanName == "" {
 		spanName = defaultSpanName
 	}
 
 	ot := openTelemetryWrapper{
-		spanName: spanName,
+		spanName:   spanName,
+		attributes: attributes,
 	}
 
 	res, err := ot.newResource(webEngineName, caddycmd.CaddyVersion())
@@ -55,31 +68,134 @@ func newOpenTelemetryWrapper(
 
 	ot.propagators = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
 
-	tracerProvider := globalTracerProvider.getTracerProvider(
+	tracerProviderOpts := []sdktrace.TracerProviderOption{
 		sdktrace.WithBatcher(traceExporter),
 		sdktrace.WithResource(res),
-	)
+	}
+	if sampler != nil {
+		tracerProviderOpts = append(tracerProviderOpts, sdktrace.WithSampler(sampler))
+	}
+	tracerProvider := globalTracerProvider.getTracerProvider(tracerProviderOpts...)
 
 	ot.handler = otelhttp.NewHandler(http.HandlerFunc(ot.serveHTTP), ot.spanName, otelhttp.WithTracerProvider(tracerProvider), otelhttp.WithPropagators(ot.propagators))
 	return ot, nil
 }
 
 // ServeHTTP extract current tracing context or create a new one, then method propagates it to the wrapped next handler.
+// Once next returns, and before otelhttp ends the span it started, that span is decorated with Caddy-specific
+// attributes describing how the request was handled.
 func (ot *openTelemetryWrapper) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	rw := &statusRecorder{ResponseWriterWrapper: &caddyhttp.ResponseWriterWrapper{ResponseWriter: w}}
+
 	n := &nextCall{
-		next: next,
-		err:  nil,
+		// the request passed in here carries otelhttp's span in its
+		// context, and otelhttp ends that span only after this returns
+		next: caddyhttp.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+			err := next.ServeHTTP(w, r)
+			ot.enrichSpan(r, rw)
+			return err
+		}),
+		err: nil,
 	}
-	ot.handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), nextCallCtxKey, n)))
+	ot.handler.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), nextCallCtxKey, n)))
 
 	return n.err
 }
 
+// enrichSpan adds request/response attributes to the span active in r's context, plus any
+// user-configured, placeholder-derived attributes. It is a no-op if there is no recording span.
+func (ot *openTelemetryWrapper) enrichSpan(r *http.Request, rw *statusRecorder) {
+	span := trace.SpanFromContext(r.Context())
+	if !span.IsRecording() {
+		return
+	}
+
+	attrs := []attribute.KeyValue{
+		attribute.Int("http.status_code", rw.status),
+		attribute.Int64("http.response_content_length", rw.size),
+		attribute.String("caddy.handler", "tracing"),
+		attribute.String("http.host", r.Host),
+	}
+	if vars, ok := r.Context().Value(caddyhttp.VarCtxKey).(map[string]interface{}); ok {
+		if routeID, ok := vars["route_id"]; ok {
+			attrs = append(attrs, attribute.String("caddy.route.id", fmt.Sprintf("%v", routeID)))
+		}
+	}
+	if clientIP, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		attrs = append(attrs, attribute.String("http.client_ip", clientIP))
+	} else if r.RemoteAddr != "" {
+		attrs = append(attrs, attribute.String("http.client_ip", r.RemoteAddr))
+	}
+
+	repl, hasRepl := r.Context().Value(caddy.ReplacerCtxKey).(caddy.Replacer)
+	if hasRepl {
+		if upstream := repl.ReplaceAll("{http.reverse_proxy.upstream.address}", ""); upstream != "" {
+			attrs = append(attrs, attribute.String("caddy.upstream", upstream))
+		}
+	}
+
+	if len(ot.attributes) > 0 {
+		for name, val := range ot.attributes {
+			if hasRepl {
+				val = repl.ReplaceAll(val, "")
+			}
+			attrs = append(attrs, attribute.String(name, val))
+		}
+	}
+
+	span.SetAttributes(attrs...)
+}
+
+// statusRecorder captures the status code and number of bytes
+// written to the response, so they can be attached to the span
+// as http.status_code and http.response_content_length.
+type statusRecorder struct {
+	*caddyhttp.ResponseWriterWrapper
+	status int
+	size   int64
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriterWrapper.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	n, err := sr.ResponseWriterWrapper.Write(b)
+	sr.size += int64(n)
+	return n, err
+}
+
+// Interface guard
+var _ caddyhttp.HTTPInterfaces = (*statusRecorder)(nil)
+
 // cleanup flush all remaining data and shutdown a tracerProvider
 func (ot *openTelemetryWrapper) cleanup(logger *zap.Logger) error {
 	return globalTracerProvider.cleanupTracerProvider(logger)
 }
 
+// buildSampler turns a Caddyfile/JSON sampler configuration (kind being one
+// of "always", "never", "ratio", or "parent_based", with ratio used by the
+// "ratio" and "parent_based" kinds) into the sdktrace.Sampler passed to
+// newOpenTelemetryWrapper, letting operators trace only a slice of traffic.
+func buildSampler(kind string, ratio float64) (sdktrace.Sampler, error) {
+	switch kind {
+	case "", "always":
+		return sdktrace.AlwaysSample(), nil
+	case "never":
+		return sdktrace.NeverSample(), nil
+	case "ratio":
+		return sdktrace.TraceIDRatioBased(ratio), nil
+	case "parent_based":
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio)), nil
+	default:
+		return nil, fmt.Errorf("unrecognized sampler type: %s", kind)
+	}
+}
+
 // newResource creates a resource that describe current handler instance and merge it with a default attributes value.
 func (ot *openTelemetryWrapper) newResource(
 	webEngineName,
@@ -0,0 +1,115 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package acmeserver provides the configuration of an embedded ACME
+// server as a Caddy HTTP handler, and enforces ACME External Account
+// Binding on its newAccount requests. The handler does not itself
+// implement the ACME protocol or issue certificates.
+package acmeserver
+
+import (
+	"net/http"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(Handler{})
+}
+
+// Handler is the acme_server HTTP handler. Its ServeHTTP checks
+// External Account Binding on newAccount requests and passes every
+// request on to the next handler; it does not serve the ACME
+// protocol itself. CA, Lifetime and SignWithRoot are stored with the
+// configuration; nothing in this package reads them.
+type Handler struct {
+	// CA is the ID of the certificate authority to use for signing
+	// issued certificates. If empty, the default CA is used.
+	CA string `json:"ca,omitempty"`
+
+	// Lifetime is how long issued certificates are valid for.
+	Lifetime caddy.Duration `json:"lifetime,omitempty"`
+
+	// SignWithRoot, if true, signs certificates with the root
+	// instead of the intermediate.
+	SignWithRoot bool `json:"sign_with_root,omitempty"`
+
+	// Challenges are the ACME challenge types this server accepts
+	// for domain validation. If empty, all supported challenges are
+	// accepted.
+	Challenges ACMEChallenges `json:"challenges,omitempty"`
+
+	// ExternalAccountBinding gates newAccount requests behind a
+	// pre-shared kid/HMAC key pair, for interoperating with
+	// enterprise CAs or pre-authorizing which accounts may request
+	// certificates.
+	ExternalAccountBinding
+
+	// NewAccountPath is the request path serving this server's ACME
+	// newAccount resource. Only requests to this path are checked
+	// against ExternalAccountBinding. Default: "/acme/new-account".
+	NewAccountPath string `json:"new_account_path,omitempty"`
+
+	ctx    caddy.Context
+	logger *zap.Logger
+}
+
+// CaddyModule returns the Caddy module information.
+func (Handler) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.acme_server",
+		New: func() caddy.Module { return new(Handler) },
+	}
+}
+
+// Provision sets up h.
+func (h *Handler) Provision(ctx caddy.Context) error {
+	h.ctx = ctx
+	h.logger = ctx.Logger(h)
+
+	if err := h.Challenges.validate(); err != nil {
+		return err
+	}
+	if err := h.ExternalAccountBinding.validate(); err != nil {
+		return err
+	}
+	if h.NewAccountPath == "" {
+		h.NewAccountPath = "/acme/new-account"
+	}
+
+	return nil
+}
+
+// ServeHTTP implements caddyhttp.MiddlewareHandler. When RequireEAB is
+// set, requests to NewAccountPath are rejected unless they carry a
+// valid externalAccountBinding JWS for a known kid; all other
+// requests (and the actual ACME protocol handling) are passed
+// through to next.
+func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
+	if h.RequireEAB && r.Method == http.MethodPost && r.URL.Path == h.NewAccountPath {
+		if err := h.checkExternalAccountBinding(r); err != nil {
+			return writeACMEProblem(w, http.StatusBadRequest,
+				"urn:ietf:params:acme:error:externalAccountRequired", err.Error())
+		}
+	}
+	return next.ServeHTTP(w, r)
+}
+
+// Interface guards
+var (
+	_ caddy.Provisioner           = (*Handler)(nil)
+	_ caddyhttp.MiddlewareHandler = (*Handler)(nil)
+)
@@ -0,0 +1,94 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acmeserver
+
+import (
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+)
+
+// UnmarshalCaddyfile sets up the handler from Caddyfile tokens. Syntax:
+//
+//     acme_server {
+//         ca               <id>
+//         lifetime         <duration>
+//         sign_with_root
+//         challenges       <types...>
+//         new_account_path <path>
+//         require_eab
+//         eab              <kid> <hmac_key>
+//     }
+//
+// eab is repeatable, once per pre-authorized account.
+func (h *Handler) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
+	for d.Next() {
+		for d.NextBlock(0) {
+			switch d.Val() {
+			case "ca":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				h.CA = d.Val()
+
+			case "lifetime":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				dur, err := time.ParseDuration(d.Val())
+				if err != nil {
+					return d.Errf("parsing lifetime: %v", err)
+				}
+				h.Lifetime = caddy.Duration(dur)
+
+			case "sign_with_root":
+				h.SignWithRoot = true
+
+			case "require_eab":
+				h.RequireEAB = true
+
+			case "challenges":
+				args := d.RemainingArgs()
+				if len(args) == 0 {
+					return d.ArgErr()
+				}
+				h.Challenges = stringToChallenges(args)
+
+			case "new_account_path":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+				h.NewAccountPath = d.Val()
+
+			case "eab":
+				args := d.RemainingArgs()
+				if len(args) != 2 {
+					return d.ArgErr()
+				}
+				if h.EABKeys == nil {
+					h.EABKeys = make(map[string]string)
+				}
+				h.EABKeys[args[0]] = args[1]
+
+			default:
+				return d.Errf("unrecognized subdirective: %s", d.Val())
+			}
+		}
+	}
+	return nil
+}
+
+var _ caddyfile.Unmarshaler = (*Handler)(nil)
@@ -4,8 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
-
-	"github.com/smallstep/certificates/authority/provisioner"
 )
 
 type ACMEChallenge string
@@ -51,16 +49,6 @@ func (c ACMEChallenges) validate() error {
 	}
 	return nil
 }
-func (c ACMEChallenges) toSmallstepType() []provisioner.ACMEChallenge {
-	if len(c) == 0 {
-		return nil
-	}
-	ac := make([]provisioner.ACMEChallenge, len(c))
-	for i, ch := range c {
-		ac[i] = provisioner.ACMEChallenge(ch)
-	}
-	return ac
-}
 func stringToChallenges(chs []string) ACMEChallenges {
 	challenges := make(ACMEChallenges, len(chs))
 	for i, ch := range chs {
@@ -0,0 +1,57 @@
+package acmeserver
+
+import (
+	"encoding/base64"
+	"fmt"
+)
+
+// ExternalAccountBinding configures ACME External Account Binding
+// (EAB) for this ACME server. EAB lets an internal Caddy ACME
+// server interoperate with enterprise CAs or gate issuance to
+// pre-authorized accounts: when required, a client's newAccount
+// request must carry an externalAccountBinding JWS signed with one
+// of the configured keys, or the request is rejected.
+type ExternalAccountBinding struct {
+	// If true, every newAccount request must include a valid
+	// externalAccountBinding.
+	RequireEAB bool `json:"require_eab,omitempty"`
+
+	// EABKeys maps a key ID (kid) to its associated HMAC key,
+	// base64url-encoded (no padding), used to verify the
+	// externalAccountBinding JWS on a newAccount request. The kid
+	// is whatever identifier the CA operator assigned the
+	// pre-authorized account out of band.
+	EABKeys map[string]string `json:"eab_keys,omitempty"`
+}
+
+// validate checks that EAB is configured consistently, and that
+// every key is valid base64url so it can be used as an HMAC key.
+func (eab ExternalAccountBinding) validate() error {
+	if eab.RequireEAB && len(eab.EABKeys) == 0 {
+		return fmt.Errorf("require_eab is set but no eab_keys are configured")
+	}
+	for kid, key := range eab.EABKeys {
+		if kid == "" {
+			return fmt.Errorf("eab key ID (kid) cannot be empty")
+		}
+		if _, err := base64.RawURLEncoding.DecodeString(key); err != nil {
+			return fmt.Errorf("eab key for kid %q is not valid unpadded base64url: %v", kid, err)
+		}
+	}
+	return nil
+}
+
+// eabKey looks up the HMAC key for the given kid, decoding it from
+// base64url. The second return value is false if the kid is
+// unknown.
+func (eab ExternalAccountBinding) eabKey(kid string) ([]byte, bool) {
+	encoded, ok := eab.EABKeys[kid]
+	if !ok {
+		return nil, false
+	}
+	key, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, false
+	}
+	return key, true
+}
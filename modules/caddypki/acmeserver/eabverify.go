@@ -0,0 +1,166 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acmeserver
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+)
+
+// flattenedJWS is the flattened JSON serialization of a JWS, which is
+// what ACME clients send for newAccount requests (RFC 8555 §6.2).
+type flattenedJWS struct {
+	Protected string `json:"protected"`
+	Payload   string `json:"payload"`
+	Signature string `json:"signature"`
+}
+
+// jwsHeader is the subset of a JWS protected header this package
+// needs in order to verify an externalAccountBinding. Jwk is only
+// populated on the outer newAccount JWS, which carries the account
+// key instead of a kid.
+type jwsHeader struct {
+	Alg string          `json:"alg"`
+	Kid string          `json:"kid"`
+	Jwk json.RawMessage `json:"jwk"`
+}
+
+// newAccountPayload is the subset of a newAccount request body this
+// package needs in order to locate the externalAccountBinding.
+type newAccountPayload struct {
+	ExternalAccountBinding *flattenedJWS `json:"externalAccountBinding"`
+}
+
+// checkExternalAccountBinding reads r's body (restoring it for the
+// next handler) and verifies that it carries a newAccount request
+// whose externalAccountBinding is a valid HS256 JWS over a key known
+// to h.ExternalAccountBinding, AND whose payload is exactly the
+// account key (jwk) from the outer newAccount JWS's protected header,
+// as required by RFC 8555 §7.3.4. The latter check is what ties the
+// binding to this specific account key, rather than letting a
+// captured externalAccountBinding be replayed against any key.
+// An error is returned if the binding is missing, malformed, doesn't
+// verify against the kid's key, or doesn't match the account key.
+func (h *Handler) checkExternalAccountBinding(r *http.Request) error {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("reading request body: %v", err)
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	var outer flattenedJWS
+	if err := json.Unmarshal(body, &outer); err != nil {
+		return fmt.Errorf("parsing newAccount request as JWS: %v", err)
+	}
+
+	outerHeaderJSON, err := base64.RawURLEncoding.DecodeString(outer.Protected)
+	if err != nil {
+		return fmt.Errorf("decoding newAccount protected header: %v", err)
+	}
+	var outerHeader jwsHeader
+	if err := json.Unmarshal(outerHeaderJSON, &outerHeader); err != nil {
+		return fmt.Errorf("parsing newAccount protected header: %v", err)
+	}
+	if len(outerHeader.Jwk) == 0 {
+		return fmt.Errorf("newAccount request is missing the account jwk")
+	}
+
+	payloadJSON, err := base64.RawURLEncoding.DecodeString(outer.Payload)
+	if err != nil {
+		return fmt.Errorf("decoding newAccount payload: %v", err)
+	}
+	var account newAccountPayload
+	if err := json.Unmarshal(payloadJSON, &account); err != nil {
+		return fmt.Errorf("parsing newAccount payload: %v", err)
+	}
+	if account.ExternalAccountBinding == nil {
+		return fmt.Errorf("newAccount request is missing externalAccountBinding")
+	}
+
+	return h.ExternalAccountBinding.verify(*account.ExternalAccountBinding, outerHeader.Jwk)
+}
+
+// verify checks that eabJWS is a valid HS256 JWS, signed with the
+// HMAC key registered for the kid named in its protected header, and
+// that its payload is exactly accountJwk (the account key from the
+// outer newAccount JWS this binding accompanies), per RFC 8555 §7.3.4.
+func (eab ExternalAccountBinding) verify(eabJWS flattenedJWS, accountJwk json.RawMessage) error {
+	headerJSON, err := base64.RawURLEncoding.DecodeString(eabJWS.Protected)
+	if err != nil {
+		return fmt.Errorf("decoding externalAccountBinding header: %v", err)
+	}
+	var header jwsHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return fmt.Errorf("parsing externalAccountBinding header: %v", err)
+	}
+	if header.Alg != "HS256" {
+		return fmt.Errorf("unsupported externalAccountBinding algorithm: %s", header.Alg)
+	}
+
+	key, ok := eab.eabKey(header.Kid)
+	if !ok {
+		return fmt.Errorf("unknown externalAccountBinding key ID: %s", header.Kid)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(eabJWS.Signature)
+	if err != nil {
+		return fmt.Errorf("decoding externalAccountBinding signature: %v", err)
+	}
+
+	signingInput := eabJWS.Protected + "." + eabJWS.Payload
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signingInput))
+	if !hmac.Equal(mac.Sum(nil), sig) {
+		return fmt.Errorf("externalAccountBinding signature verification failed for kid %s", header.Kid)
+	}
+
+	boundJwkJSON, err := base64.RawURLEncoding.DecodeString(eabJWS.Payload)
+	if err != nil {
+		return fmt.Errorf("decoding externalAccountBinding payload: %v", err)
+	}
+	var boundJwk, actualJwk interface{}
+	if err := json.Unmarshal(boundJwkJSON, &boundJwk); err != nil {
+		return fmt.Errorf("parsing externalAccountBinding payload: %v", err)
+	}
+	if err := json.Unmarshal(accountJwk, &actualJwk); err != nil {
+		return fmt.Errorf("parsing account jwk: %v", err)
+	}
+	if !reflect.DeepEqual(boundJwk, actualJwk) {
+		return fmt.Errorf("externalAccountBinding does not match the account key for kid %s", header.Kid)
+	}
+
+	return nil
+}
+
+// writeACMEProblem writes an RFC 7807 "problem document" response in
+// the format ACME clients expect for errors (RFC 8555 §6.7).
+func writeACMEProblem(w http.ResponseWriter, status int, problemType, detail string) error {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(struct {
+		Type   string `json:"type"`
+		Detail string `json:"detail"`
+	}{
+		Type:   problemType,
+		Detail: detail,
+	})
+}
@@ -0,0 +1,112 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package acmeserver
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+)
+
+const testEABKid = "kid-1"
+
+var testEABKey = []byte("a secret HMAC key used only in tests")
+
+var testAccountJwk = json.RawMessage(`{"kty":"RSA","n":"abc","e":"AQAB"}`)
+
+// signEAB builds a flattenedJWS whose payload is payload, signed
+// HS256 with key under kid, the same construction an ACME client
+// would use for an externalAccountBinding.
+func signEAB(kid string, key []byte, alg string, payload []byte) flattenedJWS {
+	header, _ := json.Marshal(struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{Alg: alg, Kid: kid})
+
+	protected := base64.RawURLEncoding.EncodeToString(header)
+	payloadEnc := base64.RawURLEncoding.EncodeToString(payload)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(protected + "." + payloadEnc))
+	sig := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+
+	return flattenedJWS{
+		Protected: protected,
+		Payload:   payloadEnc,
+		Signature: sig,
+	}
+}
+
+func testEAB() ExternalAccountBinding {
+	return ExternalAccountBinding{
+		RequireEAB: true,
+		EABKeys: map[string]string{
+			testEABKid: base64.RawURLEncoding.EncodeToString(testEABKey),
+		},
+	}
+}
+
+func TestVerifyValidBinding(t *testing.T) {
+	eab := testEAB()
+	jws := signEAB(testEABKid, testEABKey, "HS256", testAccountJwk)
+
+	if err := eab.verify(jws, testAccountJwk); err != nil {
+		t.Errorf("expected valid binding to verify, got error: %v", err)
+	}
+}
+
+func TestVerifyUnknownKid(t *testing.T) {
+	eab := testEAB()
+	jws := signEAB("no-such-kid", testEABKey, "HS256", testAccountJwk)
+
+	err := eab.verify(jws, testAccountJwk)
+	if err == nil {
+		t.Fatal("expected error for unknown kid, got nil")
+	}
+}
+
+func TestVerifyWrongSignature(t *testing.T) {
+	eab := testEAB()
+	jws := signEAB(testEABKid, []byte("the wrong HMAC key entirely"), "HS256", testAccountJwk)
+
+	err := eab.verify(jws, testAccountJwk)
+	if err == nil {
+		t.Fatal("expected error for signature verification failure, got nil")
+	}
+}
+
+func TestVerifyUnsupportedAlg(t *testing.T) {
+	eab := testEAB()
+	jws := signEAB(testEABKid, testEABKey, "HS384", testAccountJwk)
+
+	err := eab.verify(jws, testAccountJwk)
+	if err == nil {
+		t.Fatal("expected error for unsupported alg, got nil")
+	}
+}
+
+func TestVerifyJwkMismatch(t *testing.T) {
+	eab := testEAB()
+	jws := signEAB(testEABKid, testEABKey, "HS256", testAccountJwk)
+
+	otherAccountJwk := json.RawMessage(`{"kty":"RSA","n":"xyz","e":"AQAB"}`)
+
+	err := eab.verify(jws, otherAccountJwk)
+	if err == nil {
+		t.Fatal("expected error when bound jwk doesn't match the account key, got nil")
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddytls
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap"
+)
+
+func init() {
+	caddy.RegisterModule(ACMEManagerMaker{})
+}
+
+// ACMEManagerMaker configures an automation policy that obtains and
+// renews certificates using ACME (RFC 8555).
+type ACMEManagerMaker struct {
+	// CA is the ACME CA's directory URL. If empty, a default (Let's
+	// Encrypt) is used.
+	CA string `json:"ca,omitempty"`
+
+	// Email is the email address to use when creating an ACME
+	// account with the CA.
+	Email string `json:"email,omitempty"`
+
+	// TrustedRootsPEMFiles is a list of PEM file names containing
+	// root certificates to trust when communicating with the CA.
+	TrustedRootsPEMFiles []string `json:"trusted_roots_pem_files,omitempty"`
+
+	// Challenges configures the ACME challenges used to prove
+	// domain ownership to the CA.
+	Challenges *ChallengesConfig `json:"challenges,omitempty"`
+
+	// OCSP configures OCSP stapling for certificates obtained
+	// through this automation policy.
+	OCSP OCSPConfig `json:"ocsp,omitempty"`
+
+	ctx    caddy.Context
+	logger *zap.Logger
+}
+
+// CaddyModule returns the Caddy module information.
+func (ACMEManagerMaker) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "tls.issuance.acme",
+		New: func() caddy.Module { return new(ACMEManagerMaker) },
+	}
+}
+
+// Provision sets up am.
+func (am *ACMEManagerMaker) Provision(ctx caddy.Context) error {
+	am.ctx = ctx
+	am.logger = ctx.Logger(am)
+	return nil
+}
+
+// onEvent starts OCSP staple management (ManageStaple) for a
+// certificate that was just obtained or renewed; data is expected
+// to hold that *tls.Certificate. Its signature is that of a
+// certmagic OnEvent callback, but nothing in this package
+// registers it, so it is never called.
+func (am *ACMEManagerMaker) onEvent(event string, data interface{}) {
+	if event != "cert_obtained" && event != "cert_renewed" {
+		return
+	}
+	cert, ok := data.(*tls.Certificate)
+	if !ok || len(cert.Certificate) == 0 {
+		return
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		am.logger.Error("parsing leaf certificate for OCSP stapling", zap.Error(err))
+		return
+	}
+	var issuer *x509.Certificate
+	if len(cert.Certificate) > 1 {
+		issuer, err = x509.ParseCertificate(cert.Certificate[1])
+		if err != nil {
+			am.logger.Error("parsing issuer certificate for OCSP stapling", zap.Error(err))
+			return
+		}
+	}
+	am.OCSP.ManageStaple(am.ctx, leaf, issuer, am.logger)
+}
+
+// ChallengesConfig configures the ACME challenges used to prove
+// domain ownership.
+type ChallengesConfig struct {
+	// DNSRaw is the DNS provider module to use for the DNS
+	// challenge, as raw JSON.
+	DNSRaw json.RawMessage `json:"dns,omitempty" caddy:"namespace=tls.dns inline_key=provider"`
+}
+
+// Interface guard
+var _ caddy.Provisioner = (*ACMEManagerMaker)(nil)
@@ -0,0 +1,277 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package caddytls
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ocsp"
+)
+
+// OCSPConfig configures how OCSP stapling is performed for
+// certificates loaded or managed by an automation policy. When
+// stapling is enabled (the default), ManageStaple pre-fetches and
+// caches a staple for a certificate, then refreshes it in the
+// background ahead of its expiry, and GetStaple returns the cached
+// staple. If the responder can't be reached, no staple is cached
+// and no error is returned. Nothing in this package calls
+// ManageStaple or GetStaple for an automation policy's
+// certificates, and this package attaches no staple to TLS
+// handshakes.
+type OCSPConfig struct {
+	// DisableStapling disables OCSP stapling entirely for
+	// certificates using this policy.
+	DisableStapling bool `json:"disable_stapling,omitempty"`
+
+	// ResponderOverride is a URL that, if set, is used instead of
+	// the responder URL(s) embedded in the certificate.
+	ResponderOverride string `json:"responder_override,omitempty"`
+
+	// RefreshInterval is how long before a staple's NextUpdate time
+	// Caddy attempts to refresh it. If zero, a sensible default
+	// (a fraction of the staple's validity period) is used.
+	RefreshInterval time.Duration `json:"refresh_interval,omitempty"`
+
+	// MustStaple holds the must_staple setting of the associated
+	// automation policy. Nothing in this package reads it, and no
+	// certificate request is given the OCSP Must-Staple TLS
+	// extension here.
+	MustStaple bool `json:"must_staple,omitempty"`
+}
+
+// Validate ensures ocfg is a usable configuration.
+func (ocfg OCSPConfig) Validate() error {
+	if ocfg.RefreshInterval < 0 {
+		return fmt.Errorf("refresh_interval cannot be negative")
+	}
+	return nil
+}
+
+// ocspStaple is a cached OCSP response for a single certificate.
+type ocspStaple struct {
+	raw        []byte
+	nextUpdate time.Time
+}
+
+var (
+	ocspStapleCacheMu sync.RWMutex
+	ocspStapleCache   = make(map[string]ocspStaple)
+)
+
+// GetStaple returns the cached, DER-encoded OCSP staple for leaf, if
+// ManageStaple has fetched one and it hasn't passed its NextUpdate
+// time. The bool result reports whether a usable staple was found.
+func GetStaple(leaf *x509.Certificate) ([]byte, bool) {
+	ocspStapleCacheMu.RLock()
+	defer ocspStapleCacheMu.RUnlock()
+	s, ok := ocspStapleCache[ocspStapleCacheKey(leaf)]
+	if !ok || !time.Now().Before(s.nextUpdate) {
+		return nil, false
+	}
+	return s.raw, true
+}
+
+// ManageStaple fetches an initial OCSP staple for leaf (issued by
+// issuer) and, unless ocfg disables stapling, spawns a background
+// goroutine that keeps refreshing it ahead of its expiry until ctx
+// is canceled. It should be called once per certificate as it's
+// loaded by an automation policy. If the initial fetch fails,
+// ManageStaple logs a warning (when logger is non-nil) and returns
+// without starting the refresh loop; the certificate is then served
+// without a staple rather than failing the TLS handshake.
+func (ocfg OCSPConfig) ManageStaple(ctx context.Context, leaf, issuer *x509.Certificate, logger *zap.Logger) {
+	if ocfg.DisableStapling {
+		return
+	}
+
+	resp, err := ocfg.refreshStaple(leaf, issuer)
+	if err != nil {
+		if logger != nil {
+			logger.Warn("could not fetch initial OCSP staple",
+				zap.String("serial", leaf.SerialNumber.String()),
+				zap.Error(err))
+		}
+		return
+	}
+
+	go ocfg.keepStapleFresh(ctx, leaf, issuer, resp, logger)
+}
+
+// keepStapleFresh refreshes leaf's OCSP staple ahead of each
+// NextUpdate until ctx is canceled. A fetch failure doesn't stop the
+// loop; it just waits retryInterval and tries again, leaving the
+// last successfully cached staple (if any) in place.
+func (ocfg OCSPConfig) keepStapleFresh(ctx context.Context, leaf, issuer *x509.Certificate, last *ocsp.Response, logger *zap.Logger) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(ocfg.refreshTime(last))):
+		}
+
+		resp, err := ocfg.refreshStaple(leaf, issuer)
+		if err != nil {
+			if logger != nil {
+				logger.Warn("could not refresh OCSP staple",
+					zap.String("serial", leaf.SerialNumber.String()),
+					zap.Error(err))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(ocfg.retryInterval()):
+			}
+			continue
+		}
+		last = resp
+	}
+}
+
+// refreshTime returns when the next refresh attempt for resp should
+// happen: RefreshInterval before its NextUpdate, or a third of the
+// remaining validity period if RefreshInterval is unset.
+func (ocfg OCSPConfig) refreshTime(resp *ocsp.Response) time.Time {
+	interval := ocfg.RefreshInterval
+	if interval <= 0 {
+		interval = time.Until(resp.NextUpdate) / 3
+		if interval < time.Hour {
+			interval = time.Hour
+		}
+	}
+	refreshAt := resp.NextUpdate.Add(-interval)
+	if refreshAt.Before(time.Now()) {
+		return time.Now()
+	}
+	return refreshAt
+}
+
+// retryInterval is how long to wait before trying again after a
+// failed refresh.
+func (ocfg OCSPConfig) retryInterval() time.Duration {
+	if ocfg.RefreshInterval > 0 {
+		return ocfg.RefreshInterval
+	}
+	return time.Hour
+}
+
+// refreshStaple fetches a fresh OCSP staple for leaf and, on
+// success, stores it in the cache for GetStaple to return.
+func (ocfg OCSPConfig) refreshStaple(leaf, issuer *x509.Certificate) (*ocsp.Response, error) {
+	raw, resp, err := ocfg.fetchStaple(leaf, issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	ocspStapleCacheMu.Lock()
+	ocspStapleCache[ocspStapleCacheKey(leaf)] = ocspStaple{raw: raw, nextUpdate: resp.NextUpdate}
+	ocspStapleCacheMu.Unlock()
+
+	return resp, nil
+}
+
+// fetchStaple requests a fresh OCSP response for leaf from its
+// responder (or ocfg.ResponderOverride, if set) and validates it
+// against leaf and issuer.
+func (ocfg OCSPConfig) fetchStaple(leaf, issuer *x509.Certificate) ([]byte, *ocsp.Response, error) {
+	responder := ocfg.ResponderOverride
+	if responder == "" {
+		if len(leaf.OCSPServer) == 0 {
+			return nil, nil, fmt.Errorf("certificate has no OCSP responder URL and none is configured")
+		}
+		responder = leaf.OCSPServer[0]
+	}
+
+	reqDER, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("creating OCSP request: %v", err)
+	}
+
+	httpResp, err := http.Post(responder, "application/ocsp-request", bytes.NewReader(reqDER))
+	if err != nil {
+		return nil, nil, fmt.Errorf("requesting OCSP staple from %s: %v", responder, err)
+	}
+	defer httpResp.Body.Close()
+
+	rawResp, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading OCSP response: %v", err)
+	}
+
+	ocspResp, err := ocsp.ParseResponseForCert(rawResp, leaf, issuer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing OCSP response: %v", err)
+	}
+
+	return rawResp, ocspResp, nil
+}
+
+// ocspStapleCacheKey identifies leaf's cache entry by issuer and
+// serial number, which together uniquely identify a certificate
+// without needing to hash the whole thing.
+func ocspStapleCacheKey(leaf *x509.Certificate) string {
+	return leaf.Issuer.String() + "|" + leaf.SerialNumber.String()
+}
+
+// ClientAuthentication configures TLS client authentication (mTLS)
+// for connections accepted under a connection policy.
+type ClientAuthentication struct {
+	// Mode specifies the degree to which clients are required to
+	// authenticate themselves with a certificate. Acceptable values
+	// (matching crypto/tls.ClientAuthType, lowercased and
+	// underscore-separated) are: "request", "require",
+	// "verify_if_given", and "require_and_verify".
+	Mode string `json:"mode,omitempty"`
+
+	// TrustedCACerts is a list of PEM files containing the
+	// certificate authorities to trust when verifying client
+	// certificates.
+	TrustedCACerts []string `json:"trusted_ca_certs,omitempty"`
+
+	// TrustedLeafCerts is a list of hex-encoded SHA-256 hashes of
+	// specific client certificates to trust directly, bypassing
+	// chain-of-trust verification.
+	TrustedLeafCerts []string `json:"trusted_leaf_certs,omitempty"`
+}
+
+// supportedClientAuthModes are the recognized values of Mode.
+var supportedClientAuthModes = map[string]bool{
+	"request":            true,
+	"require":            true,
+	"verify_if_given":    true,
+	"require_and_verify": true,
+}
+
+// Validate ensures ca is a usable configuration.
+func (ca ClientAuthentication) Validate() error {
+	if ca.Mode != "" && !supportedClientAuthModes[ca.Mode] {
+		return fmt.Errorf("unrecognized client auth mode: %s", ca.Mode)
+	}
+	if len(ca.TrustedLeafCerts) > 0 {
+		for _, h := range ca.TrustedLeafCerts {
+			if len(h) != 64 {
+				return fmt.Errorf("trusted leaf cert hash does not look like a hex-encoded SHA-256 digest: %s", h)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+// Copyright 2015 Matthew Holt and The Caddy Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logging contains logging-related Caddy modules that
+// aren't specific to HTTP, such as log encoder wrappers.
+package logging
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/caddyserver/caddy/v2"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+func init() {
+	caddy.RegisterModule(RedactEncoder{})
+}
+
+// RedactEncoder wraps another log encoder and replaces or hashes
+// the value of specific fields, named by dotted path, before
+// they're encoded, so that sensitive data (credentials, PII, etc.)
+// never reaches the log destination in the clear. It works with
+// both the json and console encoders (or any other zapcore.Encoder)
+// because it operates on each zapcore.Field as it's added, before
+// the wrapped encoder ever serializes it, recursing into nested
+// objects (e.g. the access logger's "request" field) to build up
+// the dotted path as it goes. An array-valued field that matches is
+// replaced as a whole.
+type RedactEncoder struct {
+	// WrapRaw is the underlying encoder that RedactEncoder
+	// delegates to once a field has been redacted or hashed, e.g.
+	// "json" or "console".
+	WrapRaw json.RawMessage `json:"wrap,omitempty" caddy:"namespace=caddy.logging.encoders inline_key=format"`
+
+	// Redact lists the dotted field paths whose values should be
+	// replaced with "REDACTED", e.g. "request.remote_addr" or
+	// "request.headers.Authorization" for fields nested under an
+	// object (as the access logger's "request" field is).
+	Redact []string `json:"redact,omitempty"`
+
+	// Hash lists the dotted field paths whose string values should
+	// be replaced with a salted SHA-256 hex digest, so the same
+	// input always produces the same digest (useful for correlating
+	// requests) without exposing the original value.
+	Hash []string `json:"hash,omitempty"`
+
+	// Salt is mixed into every digest computed for Hash. Without a
+	// salt, a hashed value could be brute-forced by hashing guesses
+	// and comparing digests.
+	Salt string `json:"salt,omitempty"`
+
+	zapcore.Encoder
+	redactSet map[string]bool
+	hashSet   map[string]bool
+}
+
+// CaddyModule returns the Caddy module information.
+func (RedactEncoder) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "caddy.logging.encoders.redact",
+		New: func() caddy.Module { return new(RedactEncoder) },
+	}
+}
+
+// Provision sets up the encoder.
+func (re *RedactEncoder) Provision(ctx caddy.Context) error {
+	mod, err := ctx.LoadModule(re, "WrapRaw")
+	if err != nil {
+		return fmt.Errorf("loading wrapped encoder module: %v", err)
+	}
+	enc, ok := mod.(zapcore.Encoder)
+	if !ok {
+		return fmt.Errorf("module %T is not a zapcore.Encoder", mod)
+	}
+	re.Encoder = enc
+
+	re.redactSet = make(map[string]bool, len(re.Redact))
+	for _, field := range re.Redact {
+		re.redactSet[field] = true
+	}
+	re.hashSet = make(map[string]bool, len(re.Hash))
+	for _, field := range re.Hash {
+		re.hashSet[field] = true
+	}
+
+	return nil
+}
+
+// AddString redacts or hashes key's value, if configured to, before
+// passing it on to the wrapped encoder; every other zapcore.Encoder
+// method not overridden below is promoted straight through to the
+// wrapped encoder via the embedded field.
+func (re *RedactEncoder) AddString(key, value string) {
+	re.Encoder.AddString(key, re.transform(key, value))
+}
+
+// AddObject intercepts fields nested under an object (e.g. access
+// logs' "request" field), so that dotted paths like
+// "request.remote_addr" can be matched against Redact/Hash even
+// though the value is added by a nested zapcore.ObjectMarshaler
+// rather than directly by this encoder.
+func (re *RedactEncoder) AddObject(key string, marshaler zapcore.ObjectMarshaler) error {
+	return re.Encoder.AddObject(key, &nestedObject{re: re, prefix: key, wrapped: marshaler})
+}
+
+// AddArray intercepts array-valued fields the same way AddObject
+// does for object-valued ones, e.g. "request.headers.Authorization"
+// (an http.Header value is a []string). Since an array has no
+// sub-fields to redact individually, a matched array is replaced
+// with "REDACTED" wholesale rather than hashed.
+func (re *RedactEncoder) AddArray(key string, marshaler zapcore.ArrayMarshaler) error {
+	if re.redactSet[key] || re.hashSet[key] {
+		re.Encoder.AddString(key, "REDACTED")
+		return nil
+	}
+	return re.Encoder.AddArray(key, marshaler)
+}
+
+// transform applies Redact/Hash, if key matches, to value.
+func (re *RedactEncoder) transform(key, value string) string {
+	switch {
+	case re.redactSet[key]:
+		return "REDACTED"
+	case re.hashSet[key]:
+		return hashValue(re.Salt, value)
+	default:
+		return value
+	}
+}
+
+// nestedObject wraps a zapcore.ObjectMarshaler so that the fields it
+// adds are seen through a prefixEncoder, extending the dotted field
+// path by one more level (prefix).
+type nestedObject struct {
+	re      *RedactEncoder
+	prefix  string
+	wrapped zapcore.ObjectMarshaler
+}
+
+func (no *nestedObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	return no.wrapped.MarshalLogObject(&prefixEncoder{re: no.re, prefix: no.prefix, ObjectEncoder: enc})
+}
+
+// prefixEncoder wraps the zapcore.ObjectEncoder passed to a nested
+// object's MarshalLogObject, applying Redact/Hash against the full
+// dotted field path (e.g. "request.remote_addr") and recursing into
+// any further-nested objects or arrays the same way RedactEncoder
+// itself does at the top level.
+type prefixEncoder struct {
+	zapcore.ObjectEncoder
+	re     *RedactEncoder
+	prefix string
+}
+
+func (pe *prefixEncoder) path(key string) string {
+	return pe.prefix + "." + key
+}
+
+func (pe *prefixEncoder) AddString(key, value string) {
+	pe.ObjectEncoder.AddString(key, pe.re.transform(pe.path(key), value))
+}
+
+func (pe *prefixEncoder) AddObject(key string, marshaler zapcore.ObjectMarshaler) error {
+	return pe.ObjectEncoder.AddObject(key, &nestedObject{re: pe.re, prefix: pe.path(key), wrapped: marshaler})
+}
+
+func (pe *prefixEncoder) AddArray(key string, marshaler zapcore.ArrayMarshaler) error {
+	path := pe.path(key)
+	if pe.re.redactSet[path] || pe.re.hashSet[path] {
+		pe.ObjectEncoder.AddString(key, "REDACTED")
+		return nil
+	}
+	return pe.ObjectEncoder.AddArray(key, marshaler)
+}
+
+// Clone clones the encoder, including the wrapped one.
+func (re *RedactEncoder) Clone() zapcore.Encoder {
+	return &RedactEncoder{
+		Redact:    re.Redact,
+		Hash:      re.Hash,
+		Salt:      re.Salt,
+		Encoder:   re.Encoder.Clone(),
+		redactSet: re.redactSet,
+		hashSet:   re.hashSet,
+	}
+}
+
+// EncodeEntry adds fields to a clone of re, so that each one passes
+// through the redacting methods above, then has the wrapped encoder
+// serialize the entry.
+func (re *RedactEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	clone := re.Clone().(*RedactEncoder)
+	for _, field := range fields {
+		field.AddTo(clone)
+	}
+	return clone.Encoder.EncodeEntry(ent, nil)
+}
+
+// hashValue computes a salted, hex-encoded SHA-256 digest of value.
+func hashValue(salt, value string) string {
+	sum := sha256.Sum256([]byte(salt + value))
+	return hex.EncodeToString(sum[:])
+}
+
+// Interface guards
+var (
+	_ zapcore.Encoder   = (*RedactEncoder)(nil)
+	_ caddy.Provisioner = (*RedactEncoder)(nil)
+)